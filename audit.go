@@ -0,0 +1,357 @@
+package tinystore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+type actorKey struct{}
+
+// WithActor returns ctx carrying the actor recorded by AuditStore
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor carried by ctx, "" if none
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// FieldChange values of a changed field, masked
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditChange the diff of one item, Kind is "added", "removed" or "modified"
+type AuditChange struct {
+	Key    string                 `json:"key"`
+	Kind   string                 `json:"kind"`
+	Fields map[string]FieldChange `json:"fields,omitempty"`
+}
+
+// AuditEntry one recorded mutation, keys in their fmt.Sprint form
+type AuditEntry struct {
+	ID        string        `json:"id"`
+	Sequence  uint64        `json:"sequence"`
+	Time      time.Time     `json:"time"`
+	Actor     string        `json:"actor"`
+	Store     string        `json:"store"`
+	Operation Operation     `json:"operation"`
+	Keys      []string      `json:"keys"`
+	Changes   []AuditChange `json:"changes,omitempty"`
+}
+
+// Valid implements StoreItem.Valid, so entries can be kept in a Store
+func (entry *AuditEntry) Valid() bool {
+	return entry != nil && entry.ID != ""
+}
+
+// Validate implements StoreItem.Validate
+func (entry *AuditEntry) Validate() error {
+	if entry.Valid() {
+		return nil
+	}
+	return ErrInvalidStoreItem
+}
+
+// GetKey implements StoreItem.GetKey, "<store>#<sequence>"
+func (entry *AuditEntry) GetKey() interface{} {
+	return entry.ID
+}
+
+// AuditOptions configures an AuditStore
+type AuditOptions struct {
+	// Diff records the changed fields of every item, secret fields and Redact fields masked
+	Diff bool
+	// Redact field names masked in diffs, on top of secret fields
+	Redact []string
+	// Clock time source, nil means time.Now
+	Clock Clock
+}
+
+// AuditStore wraps a Store recording every mutation to an AuditSink, failed calls are recorded if they changed anything.
+// It implements ContextStore, the actor is taken from the context, see WithActor,
+// Store methods record no actor. Mutations are serialized, keys affected are found by comparing
+// the items before and after, so items changed in place by mutators are caught.
+// A sink failure is returned by the call, after the mutation happened, Clear reports it to OnError
+type AuditStore struct {
+	store   Store
+	context ContextStore
+	sink    AuditSink
+	options AuditOptions
+
+	// OnError called for every sink failure
+	OnError func(e error)
+
+	mutex    sync.Mutex
+	sequence uint64
+}
+
+// NewAuditStore wraps store writing entries to sink,
+// sequences carry on from the last entry of the store if the sink implements AuditReader
+func NewAuditStore(store Store, sink AuditSink, options AuditOptions) *AuditStore {
+	s := &AuditStore{store: store, context: NewContextStore(store), sink: sink, options: options}
+	if entries, e := s.Query(AuditQuery{Store: store.GetName()}); e == nil {
+		for _, entry := range entries {
+			if entry.Sequence > s.sequence {
+				s.sequence = entry.Sequence
+			}
+		}
+	}
+	return s
+}
+
+// Query reads the trail back, if the sink implements AuditReader
+func (s *AuditStore) Query(query AuditQuery) ([]AuditEntry, error) {
+	reader, ok := s.sink.(AuditReader)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return reader.Query(query)
+}
+
+// auditState an item as compared and as shown
+type auditState struct {
+	raw    map[string]interface{}
+	masked map[string]interface{}
+}
+
+// snapshot returns the state of the items matching keys, every item if keys is nil
+func (s *AuditStore) snapshot(keys []interface{}) (map[string]auditState, error) {
+	items := make([]StoreItem, 0)
+	if keys == nil {
+		items = s.store.All()
+	} else {
+		for _, key := range keys {
+			if item, e := FindByKey(s.store, key); e == nil {
+				items = append(items, item)
+			}
+		}
+	}
+	secretKeys := append(secretKeysOf(adapterName(s.store)), s.options.Redact...)
+	states := make(map[string]auditState, len(items))
+	for _, item := range items {
+		raw, e := document(item, rawSecrets, nil)
+		if e != nil {
+			return nil, e
+		}
+		state := auditState{raw: raw}
+		if s.options.Diff {
+			if state.masked, e = document(item, maskSecrets, secretKeys); e != nil {
+				return nil, e
+			}
+		}
+		states[keyString(item.GetKey())] = state
+	}
+	return states, nil
+}
+
+// diff returns the changes between two snapshots, sorted by key
+func (s *AuditStore) diff(before map[string]auditState, after map[string]auditState) []AuditChange {
+	changes := make([]AuditChange, 0)
+	for key, old := range before {
+		current, exists := after[key]
+		if !exists {
+			changes = append(changes, AuditChange{Key: key, Kind: "removed", Fields: s.fields(old.masked, nil, nil)})
+		} else if !reflect.DeepEqual(old.raw, current.raw) {
+			changes = append(changes, AuditChange{Key: key, Kind: "modified", Fields: s.fields(old.masked, current.masked, func(name string) bool {
+				return reflect.DeepEqual(old.raw[name], current.raw[name])
+			})})
+		}
+	}
+	for key, current := range after {
+		if _, exists := before[key]; !exists {
+			changes = append(changes, AuditChange{Key: key, Kind: "added", Fields: s.fields(nil, current.masked, nil)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// fields returns the masked values of the fields that changed, nil unless options.Diff
+func (s *AuditStore) fields(before map[string]interface{}, after map[string]interface{}, same func(name string) bool) map[string]FieldChange {
+	if !s.options.Diff {
+		return nil
+	}
+	fields := make(map[string]FieldChange)
+	for name, value := range before {
+		if same == nil || !same(name) {
+			fields[name] = FieldChange{Before: value, After: after[name]}
+		}
+	}
+	for name, value := range after {
+		if _, seen := before[name]; !seen {
+			fields[name] = FieldChange{After: value}
+		}
+	}
+	return fields
+}
+
+// mutate runs f recording the items matching keys, every item if keys is nil, before and after
+func (s *AuditStore) mutate(ctx context.Context, op Operation, keys []interface{}, f func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	before, e := s.snapshot(keys)
+	if e != nil {
+		return e
+	}
+	failure := f()
+	after, e := s.snapshot(keys)
+	if e != nil {
+		return e
+	}
+
+	// recorded even if f failed, bulk mutations may have been partially applied
+	changes := s.diff(before, after)
+	if failure != nil && len(changes) == 0 {
+		return failure
+	}
+	s.sequence++
+	entry := AuditEntry{
+		ID:        fmt.Sprintf("%s#%d", s.store.GetName(), s.sequence),
+		Sequence:  s.sequence,
+		Time:      s.options.Clock.Now(),
+		Actor:     ActorFrom(ctx),
+		Store:     s.store.GetName(),
+		Operation: op,
+		Keys:      make([]string, len(changes)),
+	}
+	for i, change := range changes {
+		entry.Keys[i] = change.Key
+	}
+	if s.options.Diff {
+		entry.Changes = changes
+	}
+	if e = s.sink.Write(entry); e != nil {
+		if s.OnError != nil {
+			s.OnError(e)
+		}
+		if failure == nil {
+			return e
+		}
+	}
+	return failure
+}
+
+// GetName implements Store.GetName
+func (s *AuditStore) GetName() string {
+	return s.store.GetName()
+}
+
+// AllContext implements ContextStore.AllContext
+func (s *AuditStore) AllContext(ctx context.Context) ([]StoreItem, error) {
+	return s.context.AllContext(ctx)
+}
+
+// FindContext implements ContextStore.FindContext
+func (s *AuditStore) FindContext(ctx context.Context, filter Filter) (StoreItem, error) {
+	return s.context.FindContext(ctx, filter)
+}
+
+// LoadContext implements ContextStore.LoadContext
+func (s *AuditStore) LoadContext(ctx context.Context, items ...StoreItem) error {
+	return s.mutate(ctx, OpLoad, nil, func() error {
+		return s.context.LoadContext(ctx, items...)
+	})
+}
+
+// AddContext implements ContextStore.AddContext
+func (s *AuditStore) AddContext(ctx context.Context, item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return s.mutate(ctx, OpAdd, []interface{}{item.GetKey()}, func() error {
+		return s.context.AddContext(ctx, item)
+	})
+}
+
+// RemoveContext implements ContextStore.RemoveContext
+func (s *AuditStore) RemoveContext(ctx context.Context, item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return s.mutate(ctx, OpRemove, []interface{}{item.GetKey()}, func() error {
+		return s.context.RemoveContext(ctx, item)
+	})
+}
+
+// ClearContext implements ContextStore.ClearContext
+func (s *AuditStore) ClearContext(ctx context.Context) error {
+	return s.mutate(ctx, OpClear, nil, func() error {
+		return s.context.ClearContext(ctx)
+	})
+}
+
+// RemoveWhereContext implements ContextStore.RemoveWhereContext
+func (s *AuditStore) RemoveWhereContext(ctx context.Context, filter Filter) error {
+	return s.mutate(ctx, OpRemoveWhere, nil, func() error {
+		return s.context.RemoveWhereContext(ctx, filter)
+	})
+}
+
+// ForEachContext implements ContextStore.ForEachContext
+func (s *AuditStore) ForEachContext(ctx context.Context, f Mutator) error {
+	return s.mutate(ctx, OpForEach, nil, func() error {
+		return s.context.ForEachContext(ctx, f)
+	})
+}
+
+// ForEachWhereContext implements ContextStore.ForEachWhereContext
+func (s *AuditStore) ForEachWhereContext(ctx context.Context, filter Filter, transform Mutator) error {
+	return s.mutate(ctx, OpForEachWhere, nil, func() error {
+		return s.context.ForEachWhereContext(ctx, filter, transform)
+	})
+}
+
+// All implements Store.All
+func (s *AuditStore) All() []StoreItem {
+	return s.store.All()
+}
+
+// Find implements Store.Find
+func (s *AuditStore) Find(filter Filter) (StoreItem, error) {
+	return s.store.Find(filter)
+}
+
+// Load implements Store.Load
+func (s *AuditStore) Load(items ...StoreItem) error {
+	return s.LoadContext(context.Background(), items...)
+}
+
+// Add implements Store.Add
+func (s *AuditStore) Add(item StoreItem) error {
+	return s.AddContext(context.Background(), item)
+}
+
+// Remove implements Store.Remove
+func (s *AuditStore) Remove(item StoreItem) error {
+	return s.RemoveContext(context.Background(), item)
+}
+
+// Clear implements Store.Clear
+func (s *AuditStore) Clear() {
+	s.ClearContext(context.Background())
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *AuditStore) RemoveWhere(filter Filter) error {
+	return s.RemoveWhereContext(context.Background(), filter)
+}
+
+// ForEach implements Store.ForEach
+func (s *AuditStore) ForEach(f Mutator) error {
+	return s.ForEachContext(context.Background(), f)
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (s *AuditStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return s.ForEachWhereContext(context.Background(), filter, transform)
+}
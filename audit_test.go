@@ -0,0 +1,159 @@
+package tinystore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+// Test_AuditStore
+func Test_AuditStore(t *testing.T) {
+
+	clock, advance := fakeClock()
+	sink := tinystore.NewStoreSink(&tinystore.SimpleStore{Name: "Audit"})
+	store := tinystore.NewAuditStore(&tinystore.SimpleStore{}, sink, tinystore.AuditOptions{Clock: clock})
+	ctx := tinystore.WithActor(context.Background(), "alice")
+
+	store.AddContext(ctx, &DumyyItem{"a", "1"})
+	store.AddContext(ctx, &DumyyItem{"b", "2"})
+	advance(time.Hour)
+	store.ForEachWhereContext(ctx, NameFilter("a"), func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"a", "changed"}, nil
+	})
+	store.RemoveWhere(NameFilter("b"))
+
+	if e := store.Add(&DumyyItem{"a", "again"}); e == nil {
+		t.Error("Should fail")
+		return
+	}
+
+	entries, e := store.Query(tinystore.AuditQuery{})
+	if e != nil || len(entries) != 4 {
+		t.Errorf("Failed mutations should not be recorded: %v, %v", e, entries)
+		return
+	}
+	last := entries[3]
+	if last.Operation != tinystore.OpRemoveWhere || last.Actor != "" || len(last.Keys) != 1 || last.Keys[0] != "b" || last.Changes != nil {
+		t.Errorf("Bad entry %+v", last)
+		return
+	}
+
+	byAlice, _ := store.Query(tinystore.AuditQuery{Actor: "alice", Key: "a"})
+	if len(byAlice) != 2 || byAlice[1].Operation != tinystore.OpForEachWhere {
+		t.Errorf("Should find alice's changes to a: %+v", byAlice)
+		return
+	}
+	since, _ := store.Query(tinystore.AuditQuery{Since: clock.Now()})
+	if len(since) != 2 {
+		t.Errorf("Should find 2 since: %+v", since)
+		return
+	}
+	adds, _ := store.Query(tinystore.AuditQuery{Operations: []tinystore.Operation{tinystore.OpAdd}, Limit: 1})
+	if len(adds) != 1 || adds[0].Keys[0] != "b" {
+		t.Errorf("Should find the last add: %+v", adds)
+		return
+	}
+}
+
+// Test_AuditStore_Diff
+func Test_AuditStore_Diff(t *testing.T) {
+
+	sink := tinystore.NewStoreSink(&tinystore.SimpleStore{Name: "Audit"})
+	store := tinystore.NewAuditStore(accountStore(), sink, tinystore.AuditOptions{Diff: true, Redact: []string{"Username"}})
+
+	store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		AsAccount(item).Password = "0th3r"
+		return item, nil
+	})
+	store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return item, nil
+	})
+
+	entries, _ := store.Query(tinystore.AuditQuery{Store: "Accounts"})
+	if len(entries) != 2 || len(entries[1].Keys) != 0 {
+		t.Errorf("Unchanged items should not be recorded: %+v", entries)
+		return
+	}
+	changes := entries[0].Changes
+	if len(changes) != 1 || changes[0].Kind != "modified" || len(changes[0].Fields) != 1 {
+		t.Errorf("Should record the password change: %+v", changes)
+		return
+	}
+	if field := changes[0].Fields["password"]; field.Before != "***" || field.After != "***" {
+		t.Errorf("Secrets should be masked: %+v", field)
+		return
+	}
+
+	store.Clear()
+	entries, _ = store.Query(tinystore.AuditQuery{Operations: []tinystore.Operation{tinystore.OpClear}})
+	removed := entries[0].Changes[0]
+	if removed.Kind != "removed" || removed.Fields["Username"].Before != "***" || removed.Fields["Token"].Before != "***" {
+		t.Errorf("Should redact: %+v", removed)
+		return
+	}
+}
+
+// failingSink
+type failingSink struct{}
+
+func (failingSink) Write(entry tinystore.AuditEntry) error {
+	return errors.New("sink down")
+}
+
+// Test_AuditStore_SinkError
+func Test_AuditStore_SinkError(t *testing.T) {
+
+	var reported error
+	store := tinystore.NewAuditStore(&tinystore.SimpleStore{}, failingSink{}, tinystore.AuditOptions{})
+	store.OnError = func(e error) { reported = e }
+
+	if e := store.Add(&DumyyItem{"a", "1"}); e == nil || reported == nil {
+		t.Error("Should report sink errors")
+		return
+	}
+	if tinystore.Length(store) != 1 {
+		t.Error("Mutation should happen anyway")
+		return
+	}
+	if _, e := store.Query(tinystore.AuditQuery{}); e != tinystore.ErrNotImplemented {
+		t.Error("Sink can't be read")
+		return
+	}
+}
+
+// Test_AuditStore_PartialFailure
+func Test_AuditStore_PartialFailure(t *testing.T) {
+
+	sharded := tinystore.NewShardedStore("Sharded", 4)
+	sharded.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"})
+	sink := tinystore.NewStoreSink(&tinystore.SimpleStore{Name: "Audit"})
+	store := tinystore.NewAuditStore(sharded, sink, tinystore.AuditOptions{})
+
+	failure := errors.New("failed")
+	e := store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		if item.GetKey() == "a" {
+			return nil, failure
+		}
+		return &DumyyItem{"b", "changed"}, nil
+	})
+	if e != failure {
+		t.Errorf("Should return the mutator error: %v", e)
+		return
+	}
+	entries, _ := store.Query(tinystore.AuditQuery{})
+	if len(entries) != 1 || len(entries[0].Keys) != 1 || entries[0].Keys[0] != "b" {
+		t.Errorf("Applied changes should be recorded: %+v", entries)
+		return
+	}
+
+	if e := store.RemoveWhere(NameFilter("x")); e != tinystore.ErrNotFound {
+		t.Error("Should not find x")
+		return
+	}
+	if entries, _ := store.Query(tinystore.AuditQuery{}); len(entries) != 1 {
+		t.Error("Failures changing nothing should not be recorded")
+		return
+	}
+}
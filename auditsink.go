@@ -0,0 +1,188 @@
+package tinystore
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditSink receives AuditStore entries, calls are serialized by each AuditStore
+type AuditSink interface {
+	Write(entry AuditEntry) error
+}
+
+// AuditReader is implemented by sinks able to read the trail back
+type AuditReader interface {
+	Query(query AuditQuery) ([]AuditEntry, error)
+}
+
+// AuditQuery selects entries, zero fields match everything
+type AuditQuery struct {
+	Store string
+	Actor string
+	// Key entries affecting the item matching key
+	Key interface{}
+	// Operations any of them
+	Operations []Operation
+	// Since entries at or after
+	Since time.Time
+	// Until entries before
+	Until time.Time
+	// Limit the number of entries, the most recent ones
+	Limit int
+}
+
+// Match returns true if entry is selected by the query
+func (q AuditQuery) Match(entry AuditEntry) bool {
+	if (q.Store != "" && entry.Store != q.Store) || (q.Actor != "" && entry.Actor != q.Actor) {
+		return false
+	}
+	if (!q.Since.IsZero() && entry.Time.Before(q.Since)) || (!q.Until.IsZero() && !entry.Time.Before(q.Until)) {
+		return false
+	}
+	if len(q.Operations) > 0 {
+		found := false
+		for _, op := range q.Operations {
+			found = found || op == entry.Operation
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Key != nil {
+		key := keyString(q.Key)
+		for _, affected := range entry.Keys {
+			if affected == key {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// apply sorts entries oldest first and applies the limit
+func (q AuditQuery) apply(entries []AuditEntry) []AuditEntry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries
+}
+
+// ReadAuditLog returns the entries of a JSON lines trail matching query, oldest first
+func ReadAuditLog(r io.Reader, query AuditQuery) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if e := json.Unmarshal(scanner.Bytes(), &entry); e != nil {
+			return nil, e
+		}
+		if query.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if e := scanner.Err(); e != nil {
+		return nil, e
+	}
+	return query.apply(entries), nil
+}
+
+// JSONLinesSink writes one json entry per line
+type JSONLinesSink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewJSONLinesSink writes to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{writer: w}
+}
+
+// Write implements AuditSink.Write
+func (s *JSONLinesSink) Write(entry AuditEntry) error {
+	line, e := json.Marshal(entry)
+	if e != nil {
+		return e
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, e = s.writer.Write(append(line, '\n'))
+	return e
+}
+
+// FileSink appends JSON lines to a file and reads them back
+type FileSink struct {
+	JSONLinesSink
+	file *os.File
+	path string
+}
+
+// OpenFileSink opens path for appending, creating it
+func OpenFileSink(path string) (*FileSink, error) {
+	file, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		return nil, e
+	}
+	return &FileSink{JSONLinesSink: JSONLinesSink{writer: file}, file: file, path: path}, nil
+}
+
+// Write implements AuditSink.Write, synced to disk
+func (s *FileSink) Write(entry AuditEntry) error {
+	if e := s.JSONLinesSink.Write(entry); e != nil {
+		return e
+	}
+	return s.file.Sync()
+}
+
+// Query implements AuditReader.Query
+func (s *FileSink) Query(query AuditQuery) ([]AuditEntry, error) {
+	file, e := os.Open(s.path)
+	if e != nil {
+		return nil, e
+	}
+	defer file.Close()
+	return ReadAuditLog(file, query)
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// StoreSink adds entries as *AuditEntry items to a Store
+type StoreSink struct {
+	store Store
+}
+
+// NewStoreSink writes to store
+func NewStoreSink(store Store) *StoreSink {
+	return &StoreSink{store: store}
+}
+
+// Write implements AuditSink.Write
+func (s *StoreSink) Write(entry AuditEntry) error {
+	return s.store.Add(&entry)
+}
+
+// Query implements AuditReader.Query
+func (s *StoreSink) Query(query AuditQuery) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+	for _, item := range s.store.All() {
+		if entry, ok := item.(*AuditEntry); ok && query.Match(*entry) {
+			entries = append(entries, *entry)
+		}
+	}
+	return query.apply(entries), nil
+}
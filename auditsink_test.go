@@ -0,0 +1,63 @@
+package tinystore_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_JSONLinesSink
+func Test_JSONLinesSink(t *testing.T) {
+
+	buffer := &bytes.Buffer{}
+	store := tinystore.NewAuditStore(&tinystore.SimpleStore{}, tinystore.NewJSONLinesSink(buffer), tinystore.AuditOptions{Diff: true})
+	store.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"})
+	store.RemoveContext(tinystore.WithActor(context.Background(), "bob"), &DumyyItem{"a", "1"})
+
+	if lines := bytes.Count(buffer.Bytes(), []byte("\n")); lines != 2 {
+		t.Errorf("Should write 2 lines, got %d", lines)
+		return
+	}
+	entries, e := tinystore.ReadAuditLog(buffer, tinystore.AuditQuery{Key: "a"})
+	if e != nil || len(entries) != 2 {
+		t.Errorf("Should read back: %v, %+v", e, entries)
+		return
+	}
+	if entries[0].Operation != tinystore.OpLoad || len(entries[0].Keys) != 2 || entries[1].Actor != "bob" {
+		t.Errorf("Bad entries: %+v", entries)
+		return
+	}
+	if entries[1].Changes[0].Fields["Password"].Before != "1" {
+		t.Errorf("Diff should survive json: %+v", entries[1].Changes)
+		return
+	}
+}
+
+// Test_FileSink
+func Test_FileSink(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, e := tinystore.OpenFileSink(path)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	items := &tinystore.SimpleStore{}
+	store := tinystore.NewAuditStore(items, sink, tinystore.AuditOptions{})
+	store.Add(&DumyyItem{"a", "1"})
+	sink.Close()
+
+	// reopened appends
+	sink, _ = tinystore.OpenFileSink(path)
+	defer sink.Close()
+	store = tinystore.NewAuditStore(items, sink, tinystore.AuditOptions{})
+	store.Add(&DumyyItem{"b", "2"})
+
+	entries, e := store.Query(tinystore.AuditQuery{})
+	if e != nil || len(entries) != 2 || entries[0].Keys[0] != "a" || entries[1].Keys[0] != "b" || entries[1].Sequence != 2 {
+		t.Errorf("Should append: %v, %+v", e, entries)
+		return
+	}
+}
@@ -0,0 +1,171 @@
+package tinystore
+
+// BatchItemResult outcome of a single item in a batch operation
+type BatchItemResult struct {
+	Key interface{}
+	// Err nil if the item was applied
+	Err error
+}
+
+// BatchResult per item outcomes of a batch operation, in input order
+type BatchResult struct {
+	Results []BatchItemResult
+	// Applied count of items actually added or removed
+	Applied int
+}
+
+// Failed returns the results with an error
+func (result *BatchResult) Failed() []BatchItemResult {
+	var failed []BatchItemResult
+	for _, r := range result.Results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Err returns the first item error or nil if every item was applied
+func (result *BatchResult) Err() error {
+	for _, r := range result.Results {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+	return nil
+}
+
+// abort marks every successful result as aborted, nothing was applied
+func (result *BatchResult) abort() {
+	for i := range result.Results {
+		if result.Results[i].Err == nil {
+			result.Results[i].Err = ErrBatchAborted
+		}
+	}
+	result.Applied = 0
+}
+
+// BatchStore is implemented by stores able to add and remove many items taking the lock once
+type BatchStore interface {
+	// AddMany adds every valid item whose key is not in the store nor repeated in the batch
+	AddMany(items ...StoreItem) *BatchResult
+
+	// AddManyAtomic as AddMany but adds nothing if any item fails
+	AddManyAtomic(items ...StoreItem) *BatchResult
+
+	// RemoveKeys removes items matching keys
+	RemoveKeys(keys ...interface{}) *BatchResult
+
+	// RemoveKeysAtomic as RemoveKeys but removes nothing if any key is not found
+	RemoveKeysAtomic(keys ...interface{}) *BatchResult
+}
+
+// AddMany implements BatchStore.AddMany
+func (store *SimpleStore) AddMany(items ...StoreItem) *BatchResult {
+	return store.addMany(false, items)
+}
+
+// AddManyAtomic implements BatchStore.AddManyAtomic
+func (store *SimpleStore) AddManyAtomic(items ...StoreItem) *BatchResult {
+	return store.addMany(true, items)
+}
+
+func (store *SimpleStore) addMany(allOrNothing bool, items []StoreItem) *BatchResult {
+
+	result := &BatchResult{Results: make([]BatchItemResult, len(items))}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current := store.load()
+	keys := make(map[interface{}]bool, len(current)+len(items))
+	for _, x := range current {
+		keys[x.GetKey()] = true
+	}
+
+	added := make([]StoreItem, 0, len(items))
+	for i, item := range items {
+		if item == nil {
+			result.Results[i].Err = ErrInvalidStoreItem
+			continue
+		}
+		result.Results[i].Key = item.GetKey()
+		if ex := item.Validate(); ex != nil {
+			result.Results[i].Err = ex
+			continue
+		}
+		if keys[item.GetKey()] {
+			result.Results[i].Err = ErrAlreadyExists
+			continue
+		}
+		keys[item.GetKey()] = true
+		added = append(added, item)
+	}
+
+	if allOrNothing && len(added) != len(items) {
+		result.abort()
+		return result
+	}
+
+	store.publish(append(current[:len(current):len(current)], added...))
+	store.bump()
+	for _, item := range added {
+		store.touch(item)
+	}
+	result.Applied = len(added)
+	return result
+}
+
+// RemoveKeys implements BatchStore.RemoveKeys
+func (store *SimpleStore) RemoveKeys(keys ...interface{}) *BatchResult {
+	return store.removeKeys(false, keys)
+}
+
+// RemoveKeysAtomic implements BatchStore.RemoveKeysAtomic
+func (store *SimpleStore) RemoveKeysAtomic(keys ...interface{}) *BatchResult {
+	return store.removeKeys(true, keys)
+}
+
+func (store *SimpleStore) removeKeys(allOrNothing bool, keys []interface{}) *BatchResult {
+
+	result := &BatchResult{Results: make([]BatchItemResult, len(keys))}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current := store.load()
+	existing := make(map[interface{}]bool, len(current))
+	for _, x := range current {
+		existing[x.GetKey()] = true
+	}
+
+	removed := make(map[interface{}]bool, len(keys))
+	for i, key := range keys {
+		result.Results[i].Key = key
+		// a key repeated in the batch is already gone
+		if !existing[key] || removed[key] {
+			result.Results[i].Err = ErrNotFound
+			continue
+		}
+		removed[key] = true
+	}
+
+	if len(removed) == 0 || (allOrNothing && len(removed) != len(keys)) {
+		result.abort()
+		return result
+	}
+
+	items := make([]StoreItem, 0, len(current)-len(removed))
+	for _, x := range current {
+		if !removed[x.GetKey()] {
+			items = append(items, x)
+		}
+	}
+	store.publish(items)
+	store.bump()
+	for key := range removed {
+		store.forget(key)
+	}
+	result.Applied = len(removed)
+	return result
+}
@@ -0,0 +1,89 @@
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_AddMany
+func Test_AddMany(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.Add(&DumyyItem{"me", "1234"})
+
+	result := store.AddMany(
+		&DumyyItem{"you", "1234"},
+		&DumyyItem{"me", "1234"},  // in store
+		&DumyyItem{"el", ""},      // invalid
+		&DumyyItem{"you", "4321"}, // in batch
+		&DumyyItem{"ella", "1234"},
+	)
+
+	if result.Applied != 2 || tinystore.Length(store) != 3 {
+		t.Errorf("Bad Applied: %v, Length: %v", result.Applied, tinystore.Length(store))
+		return
+	}
+	expected := []error{nil, tinystore.ErrAlreadyExists, tinystore.ErrInvalidStoreItem, tinystore.ErrAlreadyExists, nil}
+	for i, r := range result.Results {
+		if r.Err != expected[i] {
+			t.Errorf("Item %v: expected %v got %v", i, expected[i], r.Err)
+		}
+	}
+	if len(result.Failed()) != 3 || result.Err() != tinystore.ErrAlreadyExists {
+		t.Error("Bad Failed")
+	}
+	if x, _ := tinystore.FindByKey(store, "you"); AsCredential(x).Password != "1234" {
+		t.Error("Batch duplicate added")
+	}
+}
+
+// Test_AddManyAtomic
+func Test_AddManyAtomic(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+
+	result := store.AddManyAtomic(&DumyyItem{"me", "1234"}, &DumyyItem{"you", ""})
+	if result.Applied != 0 || tinystore.Length(store) != 0 {
+		t.Error("Atomic batch applied")
+		return
+	}
+	if result.Results[0].Err != tinystore.ErrBatchAborted || result.Results[1].Err != tinystore.ErrInvalidStoreItem {
+		t.Errorf("Bad results: %v", result.Results)
+	}
+
+	if result = store.AddManyAtomic(&DumyyItem{"me", "1234"}, &DumyyItem{"you", "1234"}); result.Err() != nil {
+		t.Error(result.Err())
+		return
+	}
+	if result.Applied != 2 || tinystore.Length(store) != 2 {
+		t.Error("Atomic batch not applied")
+	}
+}
+
+// Test_RemoveKeys
+func Test_RemoveKeys(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.AddMany(&DumyyItem{"me", "1234"}, &DumyyItem{"you", "1234"}, &DumyyItem{"el", "1234"})
+
+	result := store.RemoveKeysAtomic("me", "nobody")
+	if result.Applied != 0 || tinystore.Length(store) != 3 {
+		t.Error("Atomic batch applied")
+		return
+	}
+
+	result = store.RemoveKeys("me", "nobody", "you", "me")
+	if result.Applied != 2 || tinystore.Length(store) != 1 {
+		t.Errorf("Bad Applied: %v", result.Applied)
+		return
+	}
+	expected := []error{nil, tinystore.ErrNotFound, nil, tinystore.ErrNotFound}
+	for i, r := range result.Results {
+		if r.Err != expected[i] {
+			t.Errorf("Key %v: expected %v got %v", r.Key, expected[i], r.Err)
+		}
+	}
+	if _, e := tinystore.FindByKey(store, "el"); e != nil {
+		t.Error(e)
+	}
+}
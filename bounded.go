@@ -0,0 +1,403 @@
+package tinystore
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// EvictionPolicy chooses which key a BoundedStore evicts, calls are serialized by the store
+type EvictionPolicy interface {
+	// Added key was added
+	Added(key interface{})
+	// Accessed key was found by a read
+	Accessed(key interface{})
+	// Removed key is gone
+	Removed(key interface{})
+	// Victim returns the next key to evict, skipping keys where skip returns true,
+	// false if there is none
+	Victim(skip func(key interface{}) bool) (interface{}, bool)
+}
+
+// listPolicy keeps keys from oldest to newest, moving accessed keys to the back if lru
+type listPolicy struct {
+	lru      bool
+	order    *list.List
+	elements map[interface{}]*list.Element
+}
+
+// NewLRUPolicy evicts the least recently added or accessed key
+func NewLRUPolicy() EvictionPolicy {
+	return &listPolicy{lru: true, order: list.New(), elements: make(map[interface{}]*list.Element)}
+}
+
+// NewFIFOPolicy evicts the oldest key, reads don't matter
+func NewFIFOPolicy() EvictionPolicy {
+	return &listPolicy{order: list.New(), elements: make(map[interface{}]*list.Element)}
+}
+
+func (p *listPolicy) Added(key interface{}) {
+	p.Removed(key)
+	p.elements[key] = p.order.PushBack(key)
+}
+
+func (p *listPolicy) Accessed(key interface{}) {
+	if element, ok := p.elements[key]; ok && p.lru {
+		p.order.MoveToBack(element)
+	}
+}
+
+func (p *listPolicy) Removed(key interface{}) {
+	if element, ok := p.elements[key]; ok {
+		p.order.Remove(element)
+		delete(p.elements, key)
+	}
+}
+
+func (p *listPolicy) Victim(skip func(key interface{}) bool) (interface{}, bool) {
+	for element := p.order.Front(); element != nil; element = element.Next() {
+		if !skip(element.Value) {
+			return element.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lfuPolicy counts accesses, ties go to the oldest key
+type lfuPolicy struct {
+	sequence uint64
+	entries  map[interface{}]*lfuEntry
+}
+
+type lfuEntry struct {
+	count    uint64
+	sequence uint64
+}
+
+// NewLFUPolicy evicts the least frequently accessed key, Victim is O(n)
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{entries: make(map[interface{}]*lfuEntry)}
+}
+
+func (p *lfuPolicy) Added(key interface{}) {
+	p.sequence++
+	p.entries[key] = &lfuEntry{sequence: p.sequence}
+}
+
+func (p *lfuPolicy) Accessed(key interface{}) {
+	if entry, ok := p.entries[key]; ok {
+		entry.count++
+	}
+}
+
+func (p *lfuPolicy) Removed(key interface{}) {
+	delete(p.entries, key)
+}
+
+func (p *lfuPolicy) Victim(skip func(key interface{}) bool) (interface{}, bool) {
+	var victim interface{}
+	var best *lfuEntry
+	for key, entry := range p.entries {
+		if skip(key) {
+			continue
+		}
+		if best == nil || entry.count < best.count || (entry.count == best.count && entry.sequence < best.sequence) {
+			victim, best = key, entry
+		}
+	}
+	return victim, best != nil
+}
+
+// BoundedOptions configures a BoundedStore, zero limits are unbounded
+type BoundedOptions struct {
+	// MaxItems item count limit
+	MaxItems int
+	// MaxBytes limit of the sum of item sizes
+	MaxBytes int64
+	// Sizer estimates an item size, nil means its json length
+	Sizer func(item StoreItem) int64
+	// Policy nil means NewLRUPolicy()
+	Policy EvictionPolicy
+	// OnEvict called, under the store lock, for every evicted item
+	OnEvict func(item StoreItem)
+}
+
+// CacheStats hit and miss counts of Find calls
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Items     int
+	Bytes     int64
+}
+
+// BoundedStore a capacity limited Store evicting items chosen by its EvictionPolicy,
+// pinned keys are never evicted. Add fails with ErrCapacityExceeded if nothing can be evicted
+type BoundedStore struct {
+	mutex   sync.Mutex
+	store   *SimpleStore
+	options BoundedOptions
+	sizes   map[interface{}]int64
+	bytes   int64
+	pinned  map[interface{}]bool
+	stats   CacheStats
+}
+
+// NewBoundedStore returns an empty BoundedStore
+func NewBoundedStore(name string, options BoundedOptions) *BoundedStore {
+	if options.Policy == nil {
+		options.Policy = NewLRUPolicy()
+	}
+	if options.Sizer == nil {
+		options.Sizer = jsonSize
+	}
+	return &BoundedStore{
+		store:   &SimpleStore{Name: name},
+		options: options,
+		sizes:   make(map[interface{}]int64),
+		pinned:  make(map[interface{}]bool),
+	}
+}
+
+// jsonSize length of item as json, 0 if it can't be marshalled
+func jsonSize(item StoreItem) int64 {
+	bytes, e := json.Marshal(item)
+	if e != nil {
+		return 0
+	}
+	return int64(len(bytes))
+}
+
+// Pin protects key from eviction, the key does not need to be in the store
+func (s *BoundedStore) Pin(key interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pinned[key] = true
+}
+
+// Unpin makes key evictable again
+func (s *BoundedStore) Unpin(key interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pinned, key)
+}
+
+// Stats returns the current statistics
+func (s *BoundedStore) Stats() CacheStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats
+	stats.Items = len(s.sizes)
+	stats.Bytes = s.bytes
+	return stats
+}
+
+// over returns true if a limit is exceeded, caller holds the lock
+func (s *BoundedStore) over() bool {
+	return (s.options.MaxItems > 0 && len(s.sizes) > s.options.MaxItems) ||
+		(s.options.MaxBytes > 0 && s.bytes > s.options.MaxBytes)
+}
+
+// track records a new item, caller holds the lock
+func (s *BoundedStore) track(item StoreItem) {
+	size := s.options.Sizer(item)
+	s.sizes[item.GetKey()] = size
+	s.bytes += size
+	s.options.Policy.Added(item.GetKey())
+}
+
+// untrack forgets key, caller holds the lock
+func (s *BoundedStore) untrack(key interface{}) {
+	s.bytes -= s.sizes[key]
+	delete(s.sizes, key)
+	s.options.Policy.Removed(key)
+}
+
+// resize recomputes the sizes from the store items, keys changed by mutators are
+// removed from the policy and their new keys added, caller holds the lock
+func (s *BoundedStore) resize() {
+	sizes := make(map[interface{}]int64, len(s.sizes))
+	s.bytes = 0
+	for _, item := range s.store.All() {
+		key := item.GetKey()
+		_, tracked := s.sizes[key]
+		if _, seen := sizes[key]; !seen && !tracked {
+			s.options.Policy.Added(key)
+		}
+		size := s.options.Sizer(item)
+		sizes[key] += size
+		s.bytes += size
+	}
+	for key := range s.sizes {
+		if _, exists := sizes[key]; !exists {
+			s.options.Policy.Removed(key)
+		}
+	}
+	s.sizes = sizes
+}
+
+// fits returns true if item fits with only pinned items left, caller holds the lock
+func (s *BoundedStore) fits(item StoreItem) bool {
+	count, bytes := 1, s.options.Sizer(item)
+	for key, size := range s.sizes {
+		if s.pinned[key] {
+			count++
+			bytes += size
+		}
+	}
+	return (s.options.MaxItems <= 0 || count <= s.options.MaxItems) &&
+		(s.options.MaxBytes <= 0 || bytes <= s.options.MaxBytes)
+}
+
+// evict removes victims until within limits, never keep, returns false if it couldn't,
+// caller holds the lock
+func (s *BoundedStore) evict(keep interface{}) bool {
+	skip := func(key interface{}) bool {
+		return key == keep || s.pinned[key]
+	}
+	for s.over() {
+		key, ok := s.options.Policy.Victim(skip)
+		if !ok {
+			return false
+		}
+		item, e := FindByKey(s.store, key)
+		if e != nil {
+			// policy out of sync, just forget it
+			s.untrack(key)
+			continue
+		}
+		s.store.Remove(item)
+		s.untrack(key)
+		s.stats.Evictions++
+		if s.options.OnEvict != nil {
+			s.options.OnEvict(item)
+		}
+	}
+	return true
+}
+
+// GetName implements Store.GetName
+func (s *BoundedStore) GetName() string {
+	return s.store.GetName()
+}
+
+// All implements Store.All, doesn't count as access
+func (s *BoundedStore) All() []StoreItem {
+	return s.store.All()
+}
+
+// Find implements Store.Find, counts a hit and an access if found, a miss if not
+func (s *BoundedStore) Find(filter Filter) (StoreItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	item, e := s.store.Find(filter)
+	if e != nil {
+		s.stats.Misses++
+		return item, e
+	}
+	s.stats.Hits++
+	s.options.Policy.Accessed(item.GetKey())
+	return item, nil
+}
+
+// Add implements Store.Add, evicts to make room,
+// ErrCapacityExceeded if item doesn't fit even after evicting every unpinned item
+func (s *BoundedStore) Add(item StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	if !s.fits(item) {
+		return ErrCapacityExceeded
+	}
+	if e := s.store.Add(item); e != nil {
+		return e
+	}
+	s.track(item)
+	if !s.evict(item.GetKey()) {
+		s.store.Remove(item)
+		s.untrack(item.GetKey())
+		return ErrCapacityExceeded
+	}
+	return nil
+}
+
+// Remove implements Store.Remove
+func (s *BoundedStore) Remove(item StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.store.Remove(item); e != nil {
+		return e
+	}
+	s.untrack(item.GetKey())
+	return nil
+}
+
+// Clear implements Store.Clear, pins are kept
+func (s *BoundedStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.sizes {
+		s.untrack(key)
+	}
+	s.store.Clear()
+}
+
+// Load implements Store.Load, items are added in order and evicted down to the limits,
+// items whose key was already loaded are dropped
+func (s *BoundedStore) Load(items ...StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unique := make([]StoreItem, 0, len(items))
+	seen := make(map[interface{}]bool, len(items))
+	for _, item := range items {
+		if !seen[item.GetKey()] {
+			seen[item.GetKey()] = true
+			unique = append(unique, item)
+		}
+	}
+	for key := range s.sizes {
+		s.untrack(key)
+	}
+	if e := s.store.Load(unique...); e != nil {
+		return e
+	}
+	s.resize()
+	s.evict(nil)
+	return nil
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *BoundedStore) RemoveWhere(filter Filter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	removed, _ := Where(s.store, filter)
+	if e := s.store.RemoveWhere(filter); e != nil {
+		return e
+	}
+	for _, item := range removed {
+		s.untrack(item.GetKey())
+	}
+	return nil
+}
+
+// ForEach implements Store.ForEach, sizes are recomputed and items evicted if they grew
+func (s *BoundedStore) ForEach(f Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e := s.store.ForEach(f)
+	s.resize()
+	s.evict(nil)
+	return e
+}
+
+// ForEachWhere implements Store.ForEachWhere, sizes are recomputed and items evicted if they grew
+func (s *BoundedStore) ForEachWhere(filter Filter, transform Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e := s.store.ForEachWhere(filter, transform)
+	s.resize()
+	s.evict(nil)
+	return e
+}
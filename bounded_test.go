@@ -0,0 +1,138 @@
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+func boundedKeys(store tinystore.Store) []interface{} {
+	keys := make([]interface{}, 0)
+	for _, item := range store.All() {
+		keys = append(keys, item.GetKey())
+	}
+	return keys
+}
+
+func hasKeys(store tinystore.Store, keys ...string) bool {
+	if tinystore.Length(store) != len(keys) {
+		return false
+	}
+	for _, key := range keys {
+		if !tinystore.Exists(store, tinystore.KeyEqualsFilter(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Test_BoundedStore_LRU
+func Test_BoundedStore_LRU(t *testing.T) {
+
+	evicted := make([]tinystore.StoreItem, 0)
+	store := tinystore.NewBoundedStore("", tinystore.BoundedOptions{
+		MaxItems: 2,
+		OnEvict: func(item tinystore.StoreItem) {
+			evicted = append(evicted, item)
+		},
+	})
+
+	store.Add(&DumyyItem{"a", "1234"})
+	store.Add(&DumyyItem{"b", "1234"})
+	tinystore.FindByKey(store, "a")
+	store.Add(&DumyyItem{"c", "1234"})
+
+	if !hasKeys(store, "a", "c") {
+		t.Errorf("b should be evicted: %v", boundedKeys(store))
+		return
+	}
+	if len(evicted) != 1 || evicted[0].GetKey() != "b" {
+		t.Errorf("Bad evictions: %v", evicted)
+	}
+
+	tinystore.FindByKey(store, "b")
+	stats := store.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 || stats.Items != 2 {
+		t.Errorf("Bad stats: %+v", stats)
+	}
+}
+
+// Test_BoundedStore_FIFO_LFU
+func Test_BoundedStore_FIFO_LFU(t *testing.T) {
+
+	fifo := tinystore.NewBoundedStore("", tinystore.BoundedOptions{MaxItems: 2, Policy: tinystore.NewFIFOPolicy()})
+	lfu := tinystore.NewBoundedStore("", tinystore.BoundedOptions{MaxItems: 2, Policy: tinystore.NewLFUPolicy()})
+
+	for _, store := range []*tinystore.BoundedStore{fifo, lfu} {
+		store.Add(&DumyyItem{"a", "1234"})
+		store.Add(&DumyyItem{"b", "1234"})
+		tinystore.FindByKey(store, "a")
+		tinystore.FindByKey(store, "a")
+		tinystore.FindByKey(store, "b")
+		store.Add(&DumyyItem{"c", "1234"})
+	}
+
+	if !hasKeys(fifo, "b", "c") {
+		t.Errorf("FIFO should evict a: %v", boundedKeys(fifo))
+	}
+	if !hasKeys(lfu, "a", "c") {
+		t.Errorf("LFU should evict b: %v", boundedKeys(lfu))
+	}
+}
+
+// Test_BoundedStore_Bytes_Pin
+func Test_BoundedStore_Bytes_Pin(t *testing.T) {
+
+	store := tinystore.NewBoundedStore("", tinystore.BoundedOptions{
+		MaxBytes: 10,
+		Sizer: func(item tinystore.StoreItem) int64 {
+			return int64(len(AsCredential(item).Password))
+		},
+	})
+	store.Pin("a")
+
+	store.Add(&DumyyItem{"a", "1234"})
+	store.Add(&DumyyItem{"b", "1234"})
+	store.Add(&DumyyItem{"c", "1234"})
+
+	if !hasKeys(store, "a", "c") {
+		t.Errorf("b should be evicted: %v", boundedKeys(store))
+		return
+	}
+	if e := store.Add(&DumyyItem{"d", "12345678901"}); e != tinystore.ErrCapacityExceeded {
+		t.Errorf("Should not fit: %v", e)
+		return
+	}
+	if !hasKeys(store, "a", "c") || store.Stats().Bytes != 8 {
+		t.Errorf("Nothing should be evicted: %v", boundedKeys(store))
+	}
+
+	// growing items evicts others
+	store.ForEachWhere(NameFilter("a"), changePassword("12345678"))
+	if !hasKeys(store, "a") {
+		t.Errorf("c should be evicted: %v", boundedKeys(store))
+	}
+}
+
+// Test_BoundedStore_Rekey
+func Test_BoundedStore_Rekey(t *testing.T) {
+
+	store := tinystore.NewBoundedStore("", tinystore.BoundedOptions{MaxItems: 3})
+	store.Load(&DumyyItem{"a", "1234"}, &DumyyItem{"b", "1234"}, &DumyyItem{"a", "5678"}, &DumyyItem{"c", "1234"})
+	if stats := store.Stats(); stats.Items != 3 || tinystore.Length(store) != 3 {
+		t.Errorf("Duplicates should be dropped: %+v", stats)
+		return
+	}
+
+	store.ForEachWhere(NameFilter("a"), func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"z", "1234"}, nil
+	})
+	if !hasKeys(store, "b", "c", "z") || store.Stats().Items != 3 {
+		t.Errorf("Renamed keys should be tracked: %v %+v", boundedKeys(store), store.Stats())
+		return
+	}
+	store.Add(&DumyyItem{"d", "1234"})
+	if !hasKeys(store, "c", "z", "d") || store.Stats().Evictions != 1 {
+		t.Errorf("Only b should be evicted: %v", boundedKeys(store))
+		return
+	}
+}
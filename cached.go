@@ -0,0 +1,342 @@
+package tinystore
+
+import (
+	"errors"
+	"sync"
+)
+
+// WriteMode how CachedStore propagates writes to the backing store
+type WriteMode int
+
+const (
+	// WriteThrough writes the backing store first, the cache only if it succeeded
+	WriteThrough WriteMode = iota
+	// WriteBehind writes the cache and queues the backing write,
+	// errors are reported by OnError and Flush
+	WriteBehind
+)
+
+// writeQueueSize pending WriteBehind writes before writers wait
+const writeQueueSize = 1024
+
+// CachedStore wraps a slow backing Store with an in memory SimpleStore.
+// Reads are served from the cache, Find misses are looked up in the backing store,
+// All loads the whole backing store the first time. Use Invalidate and Refresh
+// to pick up changes made to the backing store by others.
+// After Close writes and backing store reads fail with ErrClosed, cached items can still be read
+type CachedStore struct {
+	backing Store
+	cache   *SimpleStore
+	mode    WriteMode
+
+	// OnError called for each failed WriteBehind write, from the writer goroutine,
+	// set it before the first write
+	OnError func(e error)
+
+	mutex  sync.Mutex
+	loaded bool
+	// stopped set by Close
+	stopped bool
+
+	writes   chan func() error
+	errMutex sync.Mutex
+	errs     []error
+	closed   chan struct{}
+}
+
+// NewCachedStore wraps backing, WriteBehind starts a writer goroutine stopped by Close
+func NewCachedStore(backing Store, mode WriteMode) *CachedStore {
+	store := &CachedStore{
+		backing: backing,
+		cache:   &SimpleStore{Name: backing.GetName()},
+		mode:    mode,
+	}
+	if mode == WriteBehind {
+		store.writes = make(chan func() error, writeQueueSize)
+		store.closed = make(chan struct{})
+		go store.writer()
+	}
+	return store
+}
+
+func (s *CachedStore) writer() {
+	defer close(s.closed)
+	for write := range s.writes {
+		if e := write(); e != nil {
+			s.errMutex.Lock()
+			s.errs = append(s.errs, e)
+			s.errMutex.Unlock()
+			onError := s.OnError
+			if onError != nil {
+				onError(e)
+			}
+		}
+	}
+}
+
+// write applies f to the backing store now or queues it, depending on mode
+func (s *CachedStore) write(f func() error) error {
+	if s.mode == WriteBehind {
+		s.writes <- f
+		return nil
+	}
+	return f()
+}
+
+// drain waits for queued writes, ErrClosed after Close, caller holds the lock
+func (s *CachedStore) drain() error {
+	if s.stopped {
+		return ErrClosed
+	}
+	if s.mode != WriteBehind {
+		return nil
+	}
+	done := make(chan struct{})
+	s.writes <- func() error {
+		close(done)
+		return nil
+	}
+	<-done
+	return nil
+}
+
+// failures returns the queued write errors since the last call joined
+func (s *CachedStore) failures() error {
+	s.errMutex.Lock()
+	defer s.errMutex.Unlock()
+	e := errors.Join(s.errs...)
+	s.errs = nil
+	return e
+}
+
+// Flush waits for queued writes, returns their errors since the last Flush joined
+func (s *CachedStore) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.drain(); e != nil {
+		return e
+	}
+	return s.failures()
+}
+
+// Close flushes and stops the writer goroutine, closing again does nothing
+func (s *CachedStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return nil
+	}
+	s.drain()
+	s.stopped = true
+	if s.mode == WriteBehind {
+		close(s.writes)
+		<-s.closed
+	}
+	return s.failures()
+}
+
+// Refresh reloads the whole cache from the backing store
+func (s *CachedStore) Refresh() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refresh()
+}
+
+// refresh caller holds the lock
+func (s *CachedStore) refresh() error {
+	if e := s.drain(); e != nil {
+		return e
+	}
+	if e := s.cache.Load(s.backing.All()...); e != nil {
+		return e
+	}
+	s.loaded = true
+	return nil
+}
+
+// Invalidate reloads the item matching key from the backing store, or drops it if it's gone
+func (s *CachedStore) Invalidate(key interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.drain(); e != nil {
+		return e
+	}
+	item, e := FindByKey(s.backing, key)
+	if e == ErrNotFound {
+		s.cache.RemoveKeys(key)
+		return nil
+	}
+	if e != nil {
+		return e
+	}
+	return s.cache.Upsert(item)
+}
+
+// GetName implements Store.GetName
+func (s *CachedStore) GetName() string {
+	return s.backing.GetName()
+}
+
+// All implements Store.All, loads the cache the first time
+func (s *CachedStore) All() []StoreItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.loaded {
+		s.refresh()
+	}
+	return s.cache.All()
+}
+
+// Find implements Store.Find, misses are looked up in the backing store unless the cache is loaded
+func (s *CachedStore) Find(filter Filter) (StoreItem, error) {
+	if item, e := s.cache.Find(filter); e == nil {
+		return item, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.loaded {
+		return nil, ErrNotFound
+	}
+	if e := s.drain(); e != nil {
+		return nil, e
+	}
+	item, e := s.backing.Find(filter)
+	if e != nil {
+		return nil, e
+	}
+	s.cache.Upsert(item)
+	return item, nil
+}
+
+// Add implements Store.Add
+func (s *CachedStore) Add(item StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return ErrClosed
+	}
+	if s.mode == WriteBehind {
+		if ex := item.Validate(); ex != nil {
+			return ex
+		}
+		if !s.loaded {
+			// the cache may not hold the key yet, the backing store has the last word
+			s.drain()
+			if current, e := FindByKey(s.backing, item.GetKey()); e == nil {
+				s.cache.Upsert(current)
+				return ErrAlreadyExists
+			}
+		}
+		if e := s.cache.Add(item); e != nil {
+			return e
+		}
+		return s.write(func() error { return s.backing.Add(item) })
+	}
+	if e := s.backing.Add(item); e != nil {
+		return e
+	}
+	return s.cache.Upsert(item)
+}
+
+// Remove implements Store.Remove
+func (s *CachedStore) Remove(item StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return ErrClosed
+	}
+	if s.mode == WriteBehind {
+		if e := s.cache.Remove(item); e != nil && s.loaded {
+			return e
+		}
+		return s.write(func() error { return s.backing.Remove(item) })
+	}
+	if e := s.backing.Remove(item); e != nil {
+		return e
+	}
+	s.cache.RemoveKeys(item.GetKey())
+	return nil
+}
+
+// Clear implements Store.Clear, does nothing after Close
+func (s *CachedStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return
+	}
+	s.cache.Clear()
+	s.loaded = true
+	s.write(func() error {
+		s.backing.Clear()
+		return nil
+	})
+}
+
+// Load implements Store.Load
+func (s *CachedStore) Load(items ...StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return ErrClosed
+	}
+	if s.mode == WriteThrough {
+		if e := s.backing.Load(items...); e != nil {
+			return e
+		}
+	} else {
+		s.write(func() error { return s.backing.Load(items...) })
+	}
+	s.loaded = true
+	return s.cache.Load(items...)
+}
+
+// bulk runs a multi item operation on the cache and the backing store, caller holds the lock.
+// Mutators run once, WriteBehind runs them against the cache then loads the result into the backing store
+func (s *CachedStore) bulk(op func(store Store) error, mutates bool) error {
+	if s.stopped {
+		return ErrClosed
+	}
+	if !s.loaded {
+		if e := s.refresh(); e != nil {
+			return e
+		}
+	}
+	if s.mode == WriteBehind {
+		if e := op(s.cache); e != nil {
+			return e
+		}
+		if !mutates {
+			return s.write(func() error { return op(s.backing) })
+		}
+		items := s.cache.All()
+		return s.write(func() error { return s.backing.Load(items...) })
+	}
+	if e := op(s.backing); e != nil {
+		return e
+	}
+	// mutators already ran against the backing store, reload rather than run them twice
+	return s.refresh()
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *CachedStore) RemoveWhere(filter Filter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	remove := func(store Store) error { return store.RemoveWhere(filter) }
+	return s.bulk(remove, false)
+}
+
+// ForEach implements Store.ForEach
+func (s *CachedStore) ForEach(f Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bulk(func(store Store) error { return store.ForEach(f) }, true)
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (s *CachedStore) ForEachWhere(filter Filter, transform Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bulk(func(store Store) error { return store.ForEachWhere(filter, transform) }, true)
+}
@@ -0,0 +1,178 @@
+package tinystore_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// countingStore counts Find and All calls reaching the wrapped store
+type countingStore struct {
+	tinystore.Store
+	reads int32
+}
+
+func (s *countingStore) Find(filter tinystore.Filter) (tinystore.StoreItem, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.Store.Find(filter)
+}
+
+func (s *countingStore) All() []tinystore.StoreItem {
+	atomic.AddInt32(&s.reads, 1)
+	return s.Store.All()
+}
+
+// Test_CachedStore_ReadThrough
+func Test_CachedStore_ReadThrough(t *testing.T) {
+
+	backing := &countingStore{Store: &tinystore.SimpleStore{Name: "backing"}}
+	backing.Add(&DumyyItem{"me", "1234"})
+	backing.Add(&DumyyItem{"you", "1234"})
+
+	store := tinystore.NewCachedStore(backing, tinystore.WriteThrough)
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		if x, e := tinystore.FindByKey(store, "me"); e != nil || AsCredentialGetName(x) != "me" {
+			t.Error("Find failed")
+			return
+		}
+	}
+	if backing.reads != 1 {
+		t.Errorf("Should read the backing store once: %v", backing.reads)
+		return
+	}
+
+	if tinystore.Length(store) != 2 {
+		t.Error("All failed")
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "nobody"); e != tinystore.ErrNotFound || backing.reads != 2 {
+		t.Errorf("Loaded cache should answer misses: %v", backing.reads)
+		return
+	}
+
+	// someone else changes the backing store
+	backing.Store.(*tinystore.SimpleStore).Replace(&DumyyItem{"me", "abcd"})
+	backing.Store.Remove(&DumyyItem{"you", "1234"})
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "1234" {
+		t.Error("Should be cached")
+		return
+	}
+	store.Invalidate("me")
+	store.Invalidate("you")
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "abcd" || tinystore.Length(store) != 1 {
+		t.Error("Invalidate failed")
+		return
+	}
+	backing.Store.Add(&DumyyItem{"el", "1234"})
+	store.Refresh()
+	if tinystore.Length(store) != 2 {
+		t.Error("Refresh failed")
+	}
+}
+
+// Test_CachedStore_WriteThrough
+func Test_CachedStore_WriteThrough(t *testing.T) {
+
+	backing := &tinystore.SimpleStore{}
+	store := tinystore.NewCachedStore(backing, tinystore.WriteThrough)
+
+	store.Add(&DumyyItem{"me", "1234"})
+	if _, e := tinystore.FindByKey(backing, "me"); e != nil {
+		t.Error("Not written through")
+		return
+	}
+	backing.Add(&DumyyItem{"you", "1234"})
+	if e := store.Add(&DumyyItem{"you", "1234"}); e != tinystore.ErrAlreadyExists {
+		t.Error("Backing store should refuse")
+		return
+	}
+
+	// mutators run once
+	store.ForEach(reversePassword)
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "4321" {
+		t.Error("ForEach failed")
+		return
+	}
+	store.RemoveWhere(NameFilter("you"))
+	if tinystore.Length(backing) != 1 || tinystore.Length(store) != 1 {
+		t.Error("RemoveWhere failed")
+	}
+}
+
+// Test_CachedStore_WriteBehind
+func Test_CachedStore_WriteBehind(t *testing.T) {
+
+	backing := &tinystore.SimpleStore{}
+	backing.Add(&DumyyItem{"you", "1234"})
+	store := tinystore.NewCachedStore(backing, tinystore.WriteBehind)
+	defer store.Close()
+
+	var failures int32
+	store.OnError = func(e error) {
+		atomic.AddInt32(&failures, 1)
+	}
+
+	store.Add(&DumyyItem{"me", "1234"})
+	// not cached yet, only the backing store knows
+	if e := store.Add(&DumyyItem{"you", "5678"}); e != tinystore.ErrAlreadyExists {
+		t.Errorf("Should check the backing store: %v", e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "you"); AsCredential(x).Password != "1234" {
+		t.Error("Cache should keep the stored item")
+		return
+	}
+	// only fails behind
+	store.Remove(&DumyyItem{"ghost", "1234"})
+	store.ForEachWhere(NameFilter("me"), reversePassword)
+
+	if e := store.Flush(); !errors.Is(e, tinystore.ErrNotFound) || atomic.LoadInt32(&failures) != 1 {
+		t.Errorf("Should report the failed write: %v", e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(backing, "me"); AsCredential(x).Password != "4321" {
+		t.Error("Not written behind")
+	}
+	if e := store.Flush(); e != nil {
+		t.Error("Errors should be reported once")
+	}
+}
+
+// Test_CachedStore_Close
+func Test_CachedStore_Close(t *testing.T) {
+
+	backing := &tinystore.SimpleStore{}
+	backing.Add(&DumyyItem{"you", "1234"})
+	store := tinystore.NewCachedStore(backing, tinystore.WriteBehind)
+	store.Add(&DumyyItem{"me", "1234"})
+
+	if e := store.Close(); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := store.Close(); e != nil {
+		t.Errorf("Close again should do nothing: %v", e)
+		return
+	}
+	if tinystore.Length(backing) != 2 {
+		t.Error("Close should flush")
+		return
+	}
+	if x, e := tinystore.FindByKey(store, "me"); e != nil || AsCredentialGetName(x) != "me" {
+		t.Error("Cached items should still be read")
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "you"); e != tinystore.ErrClosed {
+		t.Errorf("Misses should fail: %v", e)
+		return
+	}
+	for _, e := range []error{store.Flush(), store.Refresh(), store.Invalidate("me"), store.Add(&DumyyItem{"el", "1234"}), store.ForEach(reversePassword)} {
+		if e != tinystore.ErrClosed {
+			t.Errorf("Should be closed: %v", e)
+			return
+		}
+	}
+}
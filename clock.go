@@ -0,0 +1,16 @@
+package tinystore
+
+import (
+	"time"
+)
+
+// Clock returns the current time, injectable for tests
+type Clock func() time.Time
+
+// Now returns clock() or time.Now() if clock is nil
+func (clock Clock) Now() time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock()
+}
@@ -0,0 +1,76 @@
+// Command tinystore-key prints the header of a tinystore encrypted file, which cipher, KDF and key ids
+// it uses, and with -key-file or -key-env checks that the given key decrypts it.
+//
+//	tinystore-key [-key-file path | -key-env VAR] file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/D10221/tinystore"
+)
+
+func main() {
+	keyFile := flag.String("key-file", "", "key file, base64 or raw, to verify the file with")
+	keyEnv := flag.String("key-env", "", "environment variable holding a base64 key to verify the file with")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tinystore-key [-key-file path | -key-env VAR] file\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || (*keyFile != "" && *keyEnv != "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, e := ioutil.ReadFile(flag.Arg(0))
+	if e != nil {
+		fail(e)
+	}
+	header, e := tinystore.ReadHeader(data)
+	if e != nil {
+		fail(e)
+	}
+	fmt.Printf("version: %d\n", header.Version)
+	fmt.Printf("cipher: %s\n", header.Cipher)
+	if header.KDF != nil {
+		fmt.Printf("kdf: %s\n", describeKDF(header.KDF))
+	}
+	for _, wrapped := range header.Keys {
+		if wrapped.KDF != nil {
+			fmt.Printf("key: %s (%s)\n", wrapped.KeyID, describeKDF(wrapped.KDF))
+		} else {
+			fmt.Printf("key: %s\n", wrapped.KeyID)
+		}
+	}
+
+	var provider tinystore.KeyProvider
+	switch {
+	case *keyFile != "":
+		provider = tinystore.KeyFile(*keyFile)
+	case *keyEnv != "":
+		provider = tinystore.EnvKey(*keyEnv)
+	default:
+		return
+	}
+	id, e := tinystore.VerifyKey(data, provider)
+	if e != nil {
+		fail(e)
+	}
+	if id == "" {
+		id = "(no id)"
+	}
+	fmt.Printf("verified: %s\n", id)
+}
+
+func describeKDF(kdf *tinystore.KDFParams) string {
+	return fmt.Sprintf("%s, %d iterations", kdf.Name, kdf.Iterations)
+}
+
+func fail(e error) {
+	fmt.Fprintf(os.Stderr, "tinystore-key: %v\n", e)
+	os.Exit(1)
+}
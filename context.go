@@ -0,0 +1,165 @@
+package tinystore
+
+import (
+	"context"
+)
+
+// ContextStore mirrors Store with context first methods,
+// operations give up with ErrCanceled (wrapping ctx.Err()) once ctx is done
+type ContextStore interface {
+
+	// LoadContext as Store.Load
+	LoadContext(ctx context.Context, items ...StoreItem) error
+
+	// AllContext as Store.All
+	AllContext(ctx context.Context) ([]StoreItem, error)
+
+	// FindContext as Store.Find, ctx is checked between items
+	FindContext(ctx context.Context, filter Filter) (StoreItem, error)
+
+	// AddContext as Store.Add
+	AddContext(ctx context.Context, item StoreItem) error
+
+	// RemoveContext as Store.Remove
+	RemoveContext(ctx context.Context, item StoreItem) error
+
+	// ClearContext as Store.Clear
+	ClearContext(ctx context.Context) error
+
+	// ForEachContext as Store.ForEach, ctx is checked between items
+	ForEachContext(ctx context.Context, f Mutator) error
+
+	// RemoveWhereContext as Store.RemoveWhere, ctx is checked between items
+	RemoveWhereContext(ctx context.Context, f Filter) error
+
+	// ForEachWhereContext as Store.ForEachWhere, ctx is checked between items
+	ForEachWhereContext(ctx context.Context, f Filter, transform Mutator) error
+
+	// GetName as Store.GetName
+	GetName() string
+}
+
+// contextError returns ErrCanceled wrapping ctx.Err() or nil if ctx is not done
+func contextError(ctx context.Context) error {
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	return nil
+}
+
+// NewContextStore upgrades store to a ContextStore,
+// returns store itself if it already implements ContextStore.
+// Other stores are checked between items through their filters and mutators,
+// a store applying changes as it goes may be left partially changed on cancellation
+func NewContextStore(store Store) ContextStore {
+	if contextStore, ok := store.(ContextStore); ok {
+		return contextStore
+	}
+	return &contextStore{store}
+}
+
+// contextStore adapts a Store to ContextStore
+type contextStore struct {
+	store Store
+}
+
+// contextFilter is filter until ctx is done, then matches nothing
+func contextFilter(ctx context.Context, filter Filter) Filter {
+	return func(item StoreItem) bool {
+		return ctx.Err() == nil && filter(item)
+	}
+}
+
+// contextMutator is mutator until ctx is done, then fails with ErrCanceled
+func contextMutator(ctx context.Context, mutator Mutator) Mutator {
+	return func(item StoreItem) (StoreItem, error) {
+		if e := contextError(ctx); e != nil {
+			return item, e
+		}
+		return mutator(item)
+	}
+}
+
+func (s *contextStore) GetName() string {
+	return s.store.GetName()
+}
+
+func (s *contextStore) LoadContext(ctx context.Context, items ...StoreItem) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	return s.store.Load(items...)
+}
+
+func (s *contextStore) AllContext(ctx context.Context) ([]StoreItem, error) {
+	if e := contextError(ctx); e != nil {
+		return nil, e
+	}
+	return s.store.All(), nil
+}
+
+func (s *contextStore) FindContext(ctx context.Context, filter Filter) (StoreItem, error) {
+	if e := contextError(ctx); e != nil {
+		return nil, e
+	}
+	item, e := s.store.Find(contextFilter(ctx, filter))
+	if ex := contextError(ctx); ex != nil {
+		return nil, ex
+	}
+	return item, e
+}
+
+func (s *contextStore) AddContext(ctx context.Context, item StoreItem) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	return s.store.Add(item)
+}
+
+func (s *contextStore) RemoveContext(ctx context.Context, item StoreItem) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	return s.store.Remove(item)
+}
+
+func (s *contextStore) ClearContext(ctx context.Context) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	s.store.Clear()
+	return nil
+}
+
+func (s *contextStore) ForEachContext(ctx context.Context, f Mutator) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	e := s.store.ForEach(contextMutator(ctx, f))
+	if ex := contextError(ctx); ex != nil {
+		return ex
+	}
+	return e
+}
+
+func (s *contextStore) RemoveWhereContext(ctx context.Context, f Filter) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	e := s.store.RemoveWhere(contextFilter(ctx, f))
+	if ex := contextError(ctx); ex != nil {
+		return ex
+	}
+	return e
+}
+
+func (s *contextStore) ForEachWhereContext(ctx context.Context, f Filter, transform Mutator) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	e := s.store.ForEachWhere(contextFilter(ctx, f), contextMutator(ctx, transform))
+	if ex := contextError(ctx); ex != nil {
+		return ex
+	}
+	return e
+}
@@ -0,0 +1,97 @@
+package tinystore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+// plainStore hides everything but tinystore.Store
+type plainStore struct {
+	tinystore.Store
+}
+
+// Test_ContextStore_ForEach_Canceled
+func Test_ContextStore_ForEach_Canceled(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.Load(&DumyyItem{"me", "1234"}, &DumyyItem{"you", "1234"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := store.ForEachContext(ctx, func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		cancel()
+		return &DumyyItem{AsCredentialGetName(item), "xxxx"}, nil
+	})
+
+	if !errors.Is(e, tinystore.ErrCanceled) || !errors.Is(e, context.Canceled) {
+		t.Errorf("Should be canceled: %v", e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "1234" {
+		t.Error("Canceled ForEach applied")
+	}
+}
+
+// Test_ContextStore_LockTimeout
+func Test_ContextStore_LockTimeout(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.Add(&DumyyItem{"me", "1234"})
+
+	locked := make(chan bool)
+	release := make(chan bool)
+	go store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		locked <- true
+		<-release
+		return item, nil
+	})
+	<-locked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	e := store.AddContext(ctx, &DumyyItem{"you", "1234"})
+	close(release)
+
+	if !errors.Is(e, tinystore.ErrCanceled) || !errors.Is(e, context.DeadlineExceeded) {
+		t.Errorf("Should time out: %v", e)
+		return
+	}
+	if e := store.AddContext(context.Background(), &DumyyItem{"you", "1234"}); e != nil {
+		t.Error(e)
+	}
+}
+
+// Test_NewContextStore
+func Test_NewContextStore(t *testing.T) {
+
+	simple := &tinystore.SimpleStore{}
+	if tinystore.NewContextStore(simple) != tinystore.ContextStore(simple) {
+		t.Error("SimpleStore should be used as is")
+	}
+
+	store := tinystore.NewContextStore(plainStore{simple})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if e := store.LoadContext(ctx, &DumyyItem{"me", "1234"}, &DumyyItem{"you", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, e := store.FindContext(ctx, NameFilter("you")); e != nil || AsCredentialGetName(x) != "you" {
+		t.Error("Find failed")
+		return
+	}
+
+	cancel()
+	if e := store.AddContext(ctx, &DumyyItem{"el", "1234"}); !errors.Is(e, context.Canceled) {
+		t.Errorf("Should be canceled: %v", e)
+	}
+	if e := store.RemoveWhereContext(ctx, tinystore.Always); !errors.Is(e, tinystore.ErrCanceled) {
+		t.Errorf("Should be canceled: %v", e)
+	}
+	if tinystore.Length(simple) != 2 {
+		t.Error("Canceled calls changed the store")
+	}
+}
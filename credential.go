@@ -0,0 +1,258 @@
+package tinystore
+
+import (
+	"strings"
+	"sync"
+)
+
+// Hasher hashes passwords into self describing strings carrying the algorithm name and parameters
+type Hasher interface {
+	// Name algorithm name, the first "$" separated field of its hashes
+	Name() string
+	// Hash returns the encoded hash of password
+	Hash(password string) (string, error)
+	// Verify returns true if password matches encoded
+	Verify(encoded string, password string) (bool, error)
+	// NeedsRehash returns true if encoded wasn't made with the hasher current parameters
+	NeedsRehash(encoded string) bool
+}
+
+var hashers = struct {
+	sync.RWMutex
+	byName map[string]Hasher
+}{byName: map[string]Hasher{pbkdf2Name: PBKDF2Hasher{}}}
+
+// RegisterHasher makes hashes of h.Name() verifiable, PBKDF2Hasher is registered
+func RegisterHasher(h Hasher) {
+	hashers.Lock()
+	defer hashers.Unlock()
+	hashers.byName[h.Name()] = h
+}
+
+// hasherOf returns the registered Hasher of encoded
+func hasherOf(encoded string) (Hasher, error) {
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return nil, ErrInvalidHash
+	}
+	hashers.RLock()
+	defer hashers.RUnlock()
+	h, exists := hashers.byName[parts[1]]
+	if !exists {
+		return nil, ErrInvalidHash
+	}
+	return h, nil
+}
+
+// VerifyPassword checks password against encoded with the Hasher registered for its algorithm
+func VerifyPassword(encoded string, password string) (bool, error) {
+	h, e := hasherOf(encoded)
+	if e != nil {
+		return false, e
+	}
+	return h.Verify(encoded, password)
+}
+
+// Credential a user name and password hash, set Password to change the password,
+// CredentialStore hashes it into Hash and clears it
+type Credential struct {
+	Username string `json:"username"`
+	Hash     string `json:"hash,omitempty"`
+	Password Secret `json:"password,omitempty"`
+}
+
+// Valid implements StoreItem.Valid
+func (c *Credential) Valid() bool {
+	return c != nil && c.Username != "" && (c.Hash != "" || c.Password != "")
+}
+
+// Validate implements StoreItem.Validate
+func (c *Credential) Validate() error {
+	if c.Valid() {
+		return nil
+	}
+	return ErrInvalidStoreItem
+}
+
+// GetKey implements StoreItem.GetKey
+func (c *Credential) GetKey() interface{} {
+	return c.Username
+}
+
+// Clone implements Cloner
+func (c *Credential) Clone() StoreItem {
+	clone := *c
+	return &clone
+}
+
+// NewCredentialAdapter returns a StoreItemAdapter converting documents to *Credential
+func NewCredentialAdapter() StoreItemAdapter {
+	return NewDefaultStoreItemAdapter(func(doc map[string]interface{}) StoreItem {
+		credential := &Credential{}
+		credential.Username, _ = doc["username"].(string)
+		credential.Hash, _ = doc["hash"].(string)
+		password, _ := doc["password"].(string)
+		credential.Password = Secret(password)
+		return credential
+	})
+}
+
+// CredentialStore wraps a Store hashing the Password of every *Credential written through it,
+// other items pass as they are. Verify upgrades hashes made with other parameters or algorithms
+type CredentialStore struct {
+	store  Store
+	hasher Hasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewCredentialStore wraps store, nil hasher means PBKDF2Hasher{}
+func NewCredentialStore(store Store, hasher Hasher) *CredentialStore {
+	if hasher == nil {
+		hasher = PBKDF2Hasher{}
+	}
+	return &CredentialStore{store: store, hasher: hasher}
+}
+
+// hash returns item with its password hashed, a copy if it changed
+func (s *CredentialStore) hash(item StoreItem) (StoreItem, error) {
+	credential, ok := item.(*Credential)
+	if !ok || credential == nil || credential.Password == "" {
+		return item, nil
+	}
+	password, e := credential.Password.Reveal()
+	if e != nil {
+		return nil, e
+	}
+	hash, e := s.hasher.Hash(password)
+	if e != nil {
+		return nil, e
+	}
+	hashed := *credential
+	hashed.Hash, hashed.Password = hash, ""
+	return &hashed, nil
+}
+
+// hashMutator hashes the results of f
+func (s *CredentialStore) hashMutator(f Mutator) Mutator {
+	return func(item StoreItem) (StoreItem, error) {
+		result, e := f(item)
+		if e != nil {
+			return result, e
+		}
+		return s.hash(result)
+	}
+}
+
+// Verify returns nil if password matches the credential of key, ErrInvalidCredentials if not
+// or if there is no such credential. Hashes the hasher wants redone are replaced
+func (s *CredentialStore) Verify(key interface{}, password string) error {
+	item, e := FindByKey(s.store, key)
+	credential, ok := item.(*Credential)
+	if e != nil || !ok || credential.Hash == "" {
+		// same work as a real check, so timing doesn't tell unknown users apart
+		s.dummyOnce.Do(func() {
+			s.dummy, _ = s.hasher.Hash("")
+		})
+		s.hasher.Verify(s.dummy, password)
+		return ErrInvalidCredentials
+	}
+	matches, e := VerifyPassword(credential.Hash, password)
+	if e != nil {
+		return e
+	}
+	if !matches {
+		return ErrInvalidCredentials
+	}
+	if hasher, _ := hasherOf(credential.Hash); hasher.Name() != s.hasher.Name() || s.hasher.NeedsRehash(credential.Hash) {
+		return s.rehash(key, credential.Hash, password)
+	}
+	return nil
+}
+
+// rehash replaces the hash of key, unless it changed since it was verified
+func (s *CredentialStore) rehash(key interface{}, old string, password string) error {
+	hash, e := s.hasher.Hash(password)
+	if e != nil {
+		return e
+	}
+	e = s.store.ForEachWhere(KeyEqualsFilter(key), func(item StoreItem) (StoreItem, error) {
+		credential, ok := item.(*Credential)
+		if !ok || credential.Hash != old {
+			return item, nil
+		}
+		upgraded := *credential
+		upgraded.Hash = hash
+		return &upgraded, nil
+	})
+	if e == ErrNotFound {
+		// removed meanwhile, the password was right when checked
+		return nil
+	}
+	return e
+}
+
+// GetName implements Store.GetName
+func (s *CredentialStore) GetName() string {
+	return s.store.GetName()
+}
+
+// All implements Store.All
+func (s *CredentialStore) All() []StoreItem {
+	return s.store.All()
+}
+
+// Find implements Store.Find
+func (s *CredentialStore) Find(filter Filter) (StoreItem, error) {
+	return s.store.Find(filter)
+}
+
+// Add implements Store.Add, hashing the password
+func (s *CredentialStore) Add(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	hashed, e := s.hash(item)
+	if e != nil {
+		return e
+	}
+	return s.store.Add(hashed)
+}
+
+// Remove implements Store.Remove
+func (s *CredentialStore) Remove(item StoreItem) error {
+	return s.store.Remove(item)
+}
+
+// Clear implements Store.Clear
+func (s *CredentialStore) Clear() {
+	s.store.Clear()
+}
+
+// Load implements Store.Load, hashing passwords
+func (s *CredentialStore) Load(items ...StoreItem) error {
+	hashed := make([]StoreItem, len(items))
+	for i, item := range items {
+		var e error
+		if hashed[i], e = s.hash(item); e != nil {
+			return e
+		}
+	}
+	return s.store.Load(hashed...)
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *CredentialStore) RemoveWhere(filter Filter) error {
+	return s.store.RemoveWhere(filter)
+}
+
+// ForEach implements Store.ForEach, hashing passwords set by f
+func (s *CredentialStore) ForEach(f Mutator) error {
+	return s.store.ForEach(s.hashMutator(f))
+}
+
+// ForEachWhere implements Store.ForEachWhere, hashing passwords set by transform
+func (s *CredentialStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return s.store.ForEachWhere(filter, s.hashMutator(transform))
+}
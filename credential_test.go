@@ -0,0 +1,184 @@
+package tinystore_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// reverseHasher a weak Hasher standing for a legacy algorithm, test only
+type reverseHasher struct{}
+
+func (reverseHasher) Name() string {
+	return "reverse"
+}
+
+func (reverseHasher) Hash(password string) (string, error) {
+	runes := []rune(password)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return "$reverse$" + string(runes), nil
+}
+
+func (h reverseHasher) Verify(encoded string, password string) (bool, error) {
+	hash, _ := h.Hash(password)
+	return hash == encoded, nil
+}
+
+func (reverseHasher) NeedsRehash(encoded string) bool {
+	return false
+}
+
+var fastHasher = tinystore.PBKDF2Hasher{Iterations: 1000}
+
+// Test_CredentialStore
+func Test_CredentialStore(t *testing.T) {
+
+	backing := &tinystore.SimpleStore{Name: "Credentials"}
+	store := tinystore.NewCredentialStore(backing, fastHasher)
+
+	credential := &tinystore.Credential{Username: "admin", Password: "P@55w0rd!"}
+	if e := store.Add(credential); e != nil {
+		t.Error(e)
+		return
+	}
+	if credential.Password != "P@55w0rd!" {
+		t.Error("Should not change the caller item")
+		return
+	}
+	x, _ := tinystore.FindByKey(backing, "admin")
+	stored := x.(*tinystore.Credential)
+	if stored.Password != "" || !strings.HasPrefix(stored.Hash, "$pbkdf2-sha256$i=1000$") {
+		t.Errorf("Should store the hash only: %+v", stored)
+		return
+	}
+
+	if e := store.Verify("admin", "P@55w0rd!"); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := store.Verify("admin", "wrong"); e != tinystore.ErrInvalidCredentials {
+		t.Errorf("Wrong password should fail: %v", e)
+		return
+	}
+	if e := store.Verify("nobody", "P@55w0rd!"); e != tinystore.ErrInvalidCredentials {
+		t.Errorf("Unknown user should fail the same way: %v", e)
+		return
+	}
+
+	e := store.ForEachWhere(tinystore.KeyEqualsFilter("admin"), func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		changed := *item.(*tinystore.Credential)
+		changed.Password = "n3w"
+		return &changed, nil
+	})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if store.Verify("admin", "n3w") != nil || store.Verify("admin", "P@55w0rd!") == nil {
+		t.Error("Mutators should hash new passwords")
+		return
+	}
+}
+
+// Test_CredentialStore_Rehash hashes with old parameters or algorithms are upgraded by Verify
+func Test_CredentialStore_Rehash(t *testing.T) {
+
+	tinystore.RegisterHasher(reverseHasher{})
+
+	backing := &tinystore.SimpleStore{Name: "Credentials"}
+	tinystore.NewCredentialStore(backing, fastHasher).Add(&tinystore.Credential{Username: "admin", Password: "1234"})
+	tinystore.NewCredentialStore(backing, reverseHasher{}).Add(&tinystore.Credential{Username: "legacy", Password: "1234"})
+
+	store := tinystore.NewCredentialStore(backing, tinystore.PBKDF2Hasher{Iterations: 2000})
+	hashOf := func(key string) string {
+		x, _ := tinystore.FindByKey(backing, key)
+		return x.(*tinystore.Credential).Hash
+	}
+
+	if e := store.Verify("admin", "wrong"); e != tinystore.ErrInvalidCredentials || !strings.Contains(hashOf("admin"), "i=1000") {
+		t.Error("Failed checks should not rehash")
+		return
+	}
+	if e := store.Verify("admin", "1234"); e != nil || !strings.Contains(hashOf("admin"), "i=2000") {
+		t.Errorf("Should upgrade iterations: %v %s", e, hashOf("admin"))
+		return
+	}
+	if e := store.Verify("legacy", "1234"); e != nil || !strings.HasPrefix(hashOf("legacy"), "$pbkdf2-sha256$i=2000$") {
+		t.Errorf("Should upgrade algorithm: %v %s", e, hashOf("legacy"))
+		return
+	}
+	if e := store.Verify("legacy", "1234"); e != nil {
+		t.Error(e)
+		return
+	}
+
+	if _, e := tinystore.VerifyPassword("$unknown$x", "1234"); e != tinystore.ErrInvalidHash {
+		t.Errorf("Unknown algorithm should fail: %v", e)
+		return
+	}
+}
+
+// Test_CredentialStore_Json credentials round trip without their passwords
+func Test_CredentialStore_Json(t *testing.T) {
+
+	backing := &tinystore.SimpleStore{Name: "JsonCredentials"}
+	tinystore.RegisterStoreAdapter(backing, tinystore.NewCredentialAdapter())
+	store := tinystore.NewCredentialStore(backing, fastHasher)
+
+	if e := tinystore.LoadJson(store, []byte(`[{"username": "admin", "password": "P@55w0rd!"}]`)); e != nil {
+		t.Error(e)
+		return
+	}
+	bytes, e := tinystore.SaveJson(store)
+	if e != nil || strings.Contains(string(bytes), "P@55w0rd!") || !strings.Contains(string(bytes), "pbkdf2") {
+		t.Errorf("Should save hashes only: %s %v", bytes, e)
+		return
+	}
+	store.Clear()
+	tinystore.LoadJson(store, bytes)
+	if e := store.Verify("admin", "P@55w0rd!"); e != nil {
+		t.Error(e)
+		return
+	}
+}
+
+// Test_Credential_Masked passwords waiting to be hashed never print
+func Test_Credential_Masked(t *testing.T) {
+
+	credential := &tinystore.Credential{Username: "admin", Password: "P@55w0rd!"}
+	bytes, _ := json.Marshal(credential)
+	for _, text := range []string{fmt.Sprintf("%+v", *credential), fmt.Sprintf("%#v", *credential), string(bytes)} {
+		if strings.Contains(text, "P@55w0rd!") {
+			t.Errorf("Should mask: %s", text)
+			return
+		}
+	}
+
+	tinystore.SetSecretKey(testKey(1))
+	defer tinystore.SetSecretKey(nil)
+
+	backing := &tinystore.SimpleStore{Name: "SealedCredentials"}
+	tinystore.RegisterStoreAdapter(backing, tinystore.NewCredentialAdapter())
+	backing.Add(credential)
+	saved, e := tinystore.SaveJson(backing)
+	if e != nil || strings.Contains(string(saved), "P@55w0rd!") {
+		t.Errorf("Should seal: %s %v", saved, e)
+		return
+	}
+	backing.Clear()
+	tinystore.LoadJson(backing, saved)
+	x, _ := tinystore.FindByKey(backing, "admin")
+	if !x.(*tinystore.Credential).Password.Sealed() {
+		t.Error("Should stay sealed until read")
+		return
+	}
+	store := tinystore.NewCredentialStore(&tinystore.SimpleStore{}, fastHasher)
+	store.Load(x)
+	if e := store.Verify("admin", "P@55w0rd!"); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,292 @@
+package tinystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// encryptedVersion file encrypted directly with the provider key
+	encryptedVersion = 1
+	// envelopeVersion file encrypted with a data key wrapped by identified keys
+	envelopeVersion = 2
+)
+
+// KDFParams key derivation parameters recorded in the header of files encrypted with a derived key
+type KDFParams struct {
+	Name       string `json:"name"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+}
+
+// EncryptedHeader describes how an encrypted file was encrypted, it is authenticated with the data
+type EncryptedHeader struct {
+	Version int        `json:"version"`
+	Cipher  string     `json:"cipher"`
+	Nonce   []byte     `json:"nonce"`
+	KDF     *KDFParams `json:"kdf,omitempty"`
+	// Keys the data key wrapped by each key able to decrypt the file, version 2 only
+	Keys []WrappedKey `json:"keys,omitempty"`
+}
+
+// KeyIDs ids of the keys able to decrypt the file, none if it was encrypted directly
+func (h EncryptedHeader) KeyIDs() []string {
+	ids := make([]string, len(h.Keys))
+	for i, wrapped := range h.Keys {
+		ids[i] = wrapped.KeyID
+	}
+	return ids
+}
+
+// encryptedFile the header is kept raw, its exact bytes are the GCM additional data
+type encryptedFile struct {
+	Header json.RawMessage `json:"header"`
+	Data   []byte          `json:"data"`
+}
+
+// KeyProvider supplies AES keys, 16, 24 or 32 bytes long
+type KeyProvider interface {
+	// NewKey returns the key to encrypt with and its KDF parameters, nil if it isn't derived
+	NewKey() ([]byte, *KDFParams, error)
+	// Key returns the key to decrypt a file whose header has kdf
+	Key(kdf *KDFParams) ([]byte, error)
+}
+
+// StaticKey a KeyProvider returning the key as is
+type StaticKey []byte
+
+func (k StaticKey) NewKey() ([]byte, *KDFParams, error) {
+	key, e := k.Key(nil)
+	return key, nil, e
+}
+
+func (k StaticKey) Key(kdf *KDFParams) ([]byte, error) {
+	switch len(k) {
+	case 16, 24, 32:
+		return k, nil
+	}
+	return nil, fmt.Errorf("tinystore: invalid AES key length %d", len(k))
+}
+
+// EnvKey a KeyProvider reading a base64 encoded key from the environment variable it names
+type EnvKey string
+
+func (k EnvKey) NewKey() ([]byte, *KDFParams, error) {
+	key, e := k.Key(nil)
+	return key, nil, e
+}
+
+func (k EnvKey) Key(kdf *KDFParams) ([]byte, error) {
+	value, ok := os.LookupEnv(string(k))
+	if !ok {
+		return nil, fmt.Errorf("tinystore: key variable %s is not set", string(k))
+	}
+	return decodeKey(value)
+}
+
+// KeyFile a KeyProvider reading a key from the file it names, base64 text or raw bytes
+type KeyFile string
+
+func (k KeyFile) NewKey() ([]byte, *KDFParams, error) {
+	key, e := k.Key(nil)
+	return key, nil, e
+}
+
+func (k KeyFile) Key(kdf *KDFParams) ([]byte, error) {
+	bytes, e := ioutil.ReadFile(string(k))
+	if e != nil {
+		return nil, e
+	}
+	if key, e := decodeKey(string(bytes)); e == nil {
+		return key, nil
+	}
+	return StaticKey(bytes).Key(nil)
+}
+
+// decodeKey decodes a base64 key
+func decodeKey(text string) ([]byte, error) {
+	key, e := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if e != nil {
+		return nil, fmt.Errorf("tinystore: key is not base64: %w", e)
+	}
+	return StaticKey(key).Key(nil)
+}
+
+// cipherName header cipher name for a key
+func cipherName(key []byte) string {
+	return fmt.Sprintf("AES-%d-GCM", len(key)*8)
+}
+
+// Encrypt encrypts plaintext with AES-GCM under a key from provider,
+// a Keyring encrypts with a data key wrapped by its current key
+func Encrypt(plaintext []byte, provider KeyProvider) ([]byte, error) {
+	header := EncryptedHeader{Version: encryptedVersion}
+	var key []byte
+	var e error
+	if ring, ok := provider.(*Keyring); ok {
+		header.Version = envelopeVersion
+		key, header.Keys, e = ring.wrap()
+	} else {
+		key, header.KDF, e = provider.NewKey()
+	}
+	if e != nil {
+		return nil, e
+	}
+	header.Cipher = cipherName(key)
+	if header.Nonce, e = randomNonce(key); e != nil {
+		return nil, e
+	}
+	raw, e := json.Marshal(header)
+	if e != nil {
+		return nil, e
+	}
+	gcm, e := newGCM(key)
+	if e != nil {
+		return nil, e
+	}
+	return json.Marshal(encryptedFile{Header: raw, Data: gcm.Seal(nil, header.Nonce, plaintext, raw)})
+}
+
+// Decrypt returns the plaintext of data encrypted by Encrypt,
+// ErrDecryptionFailed if the key is wrong or data was tampered with
+func Decrypt(data []byte, provider KeyProvider) ([]byte, error) {
+	plaintext, _, e := decrypt(data, provider)
+	return plaintext, e
+}
+
+// VerifyKey returns the id of the key in provider that decrypts data, "" if the file has no key ids
+func VerifyKey(data []byte, provider KeyProvider) (string, error) {
+	_, id, e := decrypt(data, provider)
+	return id, e
+}
+
+// decrypt returns the plaintext and the id of the key that decrypted it
+func decrypt(data []byte, provider KeyProvider) ([]byte, string, error) {
+	file, header, e := parseEncrypted(data)
+	if e != nil {
+		return nil, "", e
+	}
+	ring, isRing := provider.(*Keyring)
+	if header.Version == encryptedVersion && isRing {
+		return ring.openDirect(header, file)
+	}
+	var key []byte
+	id := ""
+	if header.Version == envelopeVersion {
+		key, id, e = unwrap(header.Keys, provider)
+	} else {
+		key, e = provider.Key(header.KDF)
+	}
+	if e != nil {
+		return nil, "", e
+	}
+	plaintext, e := open(key, header.Cipher, header.Nonce, file.Data, file.Header)
+	return plaintext, id, e
+}
+
+// open decrypts sealed with key, checking it matches cipher
+func open(key []byte, cipher string, nonce []byte, sealed []byte, additional []byte) ([]byte, error) {
+	if cipherName(key) != cipher {
+		return nil, ErrDecryptionFailed.Wrap(fmt.Errorf("key is for %s, file uses %s", cipherName(key), cipher))
+	}
+	gcm, e := newGCM(key)
+	if e != nil {
+		return nil, e
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrInvalidEncryptedData
+	}
+	plaintext, e := gcm.Open(nil, nonce, sealed, additional)
+	if e != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// randomNonce a new GCM nonce
+func randomNonce(key []byte) ([]byte, error) {
+	gcm, e := newGCM(key)
+	if e != nil {
+		return nil, e
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, e = rand.Read(nonce)
+	return nonce, e
+}
+
+// ReadHeader returns the header of encrypted data without decrypting it, the header is not
+// authenticated until the data is decrypted
+func ReadHeader(data []byte) (EncryptedHeader, error) {
+	_, header, e := parseEncrypted(data)
+	return header, e
+}
+
+func parseEncrypted(data []byte) (file encryptedFile, header EncryptedHeader, e error) {
+	if e = json.Unmarshal(data, &file); e != nil || len(file.Header) == 0 {
+		return file, header, ErrInvalidEncryptedData.Wrap(e)
+	}
+	if e = json.Unmarshal(file.Header, &header); e != nil {
+		return file, header, ErrInvalidEncryptedData.Wrap(e)
+	}
+	if header.Version != encryptedVersion && header.Version != envelopeVersion {
+		return file, header, ErrInvalidEncryptedData.Wrap(fmt.Errorf("unsupported version %d", header.Version))
+	}
+	if !strings.HasPrefix(header.Cipher, "AES-") || !strings.HasSuffix(header.Cipher, "-GCM") {
+		return file, header, ErrInvalidEncryptedData.Wrap(fmt.Errorf("unsupported cipher %q", header.Cipher))
+	}
+	if header.Version == envelopeVersion && (len(header.Keys) == 0 || len(header.Keys) > maxWrappedKeys) {
+		return file, header, ErrInvalidEncryptedData.Wrap(fmt.Errorf("%d wrapped keys", len(header.Keys)))
+	}
+	return file, header, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveEncrypted returns the store items as encrypted json
+func SaveEncrypted(store Store, provider KeyProvider) ([]byte, error) {
+	bytes, e := SaveJson(store)
+	if e != nil {
+		return nil, e
+	}
+	return Encrypt(bytes, provider)
+}
+
+// SaveEncryptedFile writes SaveEncrypted to path, replacing it atomically
+func SaveEncryptedFile(store Store, path string, provider KeyProvider) error {
+	bytes, e := SaveEncrypted(store, provider)
+	if e != nil {
+		return e
+	}
+	return writeFile(path, bytes)
+}
+
+// LoadEncrypted decrypts data and loads it like LoadJson, nothing is loaded if decryption fails
+func LoadEncrypted(store Store, data []byte, provider KeyProvider) error {
+	bytes, e := Decrypt(data, provider)
+	if e != nil {
+		return e
+	}
+	return LoadJson(store, bytes)
+}
+
+// LoadEncryptedFile reads path and loads it like LoadEncrypted
+func LoadEncryptedFile(store Store, path string, provider KeyProvider) error {
+	bytes, e := ioutil.ReadFile(path)
+	if e != nil {
+		return e
+	}
+	return LoadEncrypted(store, bytes, provider)
+}
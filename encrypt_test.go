@@ -0,0 +1,145 @@
+package tinystore_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+func testKey(b byte) tinystore.StaticKey {
+	return tinystore.StaticKey(bytes.Repeat([]byte{b}, 32))
+}
+
+// credentialStore a registered store loaded with testdata/credentials.json
+func credentialStore(t *testing.T) *tinystore.SimpleStore {
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	tinystore.RegisterStoreAdapter(store, tinystore.NewDefaultStoreItemAdapter(convert))
+	if e := tinystore.LoadJsonFile(store, "testdata/credentials.json"); e != nil {
+		t.Fatal(e)
+	}
+	return store
+}
+
+// Test_SaveJsonFile
+func Test_SaveJsonFile(t *testing.T) {
+
+	store := credentialStore(t)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+
+	if e := tinystore.SaveJsonFile(store, path); e != nil {
+		t.Error(e)
+		return
+	}
+	store.Clear()
+	if e := tinystore.LoadJsonFile(store, path); e != nil || tinystore.Length(store) != 2 {
+		t.Error("Should load what was saved")
+		return
+	}
+}
+
+// Test_Encrypted
+func Test_Encrypted(t *testing.T) {
+
+	store := credentialStore(t)
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+
+	if e := tinystore.SaveEncryptedFile(store, path, testKey(1)); e != nil {
+		t.Error(e)
+		return
+	}
+	data, _ := ioutil.ReadFile(path)
+	if bytes.Contains(data, []byte("P@55w0rd!")) {
+		t.Error("Should not contain plaintext")
+		return
+	}
+	header, e := tinystore.ReadHeader(data)
+	if e != nil || header.Cipher != "AES-256-GCM" || header.KDF != nil {
+		t.Errorf("Bad header: %+v %v", header, e)
+		return
+	}
+
+	store.Clear()
+	if e := tinystore.LoadEncryptedFile(store, path, testKey(2)); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Wrong key should fail: %v", e)
+		return
+	}
+	if tinystore.Length(store) != 0 {
+		t.Error("Nothing should be loaded")
+		return
+	}
+	if e := tinystore.LoadEncryptedFile(store, path, testKey(1)); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "admin"); x == nil || AsCredential(x).Password != "P@55w0rd!" {
+		t.Error("Should load what was saved")
+		return
+	}
+
+	if _, e := tinystore.Decrypt([]byte(`[]`), testKey(1)); !errors.Is(e, tinystore.ErrInvalidEncryptedData) {
+		t.Errorf("Should not be encrypted: %v", e)
+		return
+	}
+}
+
+// Test_Encrypted_Tampered both the data and the header are authenticated
+func Test_Encrypted_Tampered(t *testing.T) {
+
+	data, _ := tinystore.Encrypt([]byte(`[]`), testKey(1))
+
+	tampered := bytes.Replace(data, []byte(`"version":1`), []byte(`"version":1 `), 1)
+	if _, e := tinystore.Decrypt(tampered, testKey(1)); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Tampered header should fail: %v", e)
+		return
+	}
+
+	tampered = append([]byte{}, data...)
+	i := bytes.Index(tampered, []byte(`"data":"`)) + len(`"data":"`)
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+	if _, e := tinystore.Decrypt(tampered, testKey(1)); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Tampered data should fail: %v", e)
+		return
+	}
+
+	if _, e := tinystore.Decrypt(data, tinystore.StaticKey(bytes.Repeat([]byte{1}, 16))); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Other key size should fail: %v", e)
+		return
+	}
+}
+
+// Test_KeyProviders
+func Test_KeyProviders(t *testing.T) {
+
+	key := testKey(7)
+	t.Setenv("TINYSTORE_TEST_KEY", base64.StdEncoding.EncodeToString(key))
+
+	path := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	raw := filepath.Join(t.TempDir(), "key.bin")
+	ioutil.WriteFile(raw, key, 0600)
+
+	data, _ := tinystore.Encrypt([]byte(`[]`), key)
+	for _, provider := range []tinystore.KeyProvider{tinystore.EnvKey("TINYSTORE_TEST_KEY"), tinystore.KeyFile(path), tinystore.KeyFile(raw)} {
+		if plaintext, e := tinystore.Decrypt(data, provider); e != nil || string(plaintext) != `[]` {
+			t.Errorf("%T failed: %v", provider, e)
+			return
+		}
+	}
+
+	if _, e := tinystore.Encrypt([]byte(`[]`), tinystore.EnvKey("TINYSTORE_NO_SUCH_KEY")); e == nil {
+		t.Error("Missing variable should fail")
+		return
+	}
+	if _, e := tinystore.Encrypt([]byte(`[]`), tinystore.StaticKey("short")); e == nil {
+		t.Error("Bad key length should fail")
+		return
+	}
+}
@@ -0,0 +1,314 @@
+package tinystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event a domain event, Data is the json encoded payload
+type Event struct {
+	Sequence uint64          `json:"sequence"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// Decode unmarshals the event payload into v
+func (event Event) Decode(v interface{}) error {
+	return json.Unmarshal(event.Data, v)
+}
+
+// Reducer applies event to the projection state
+type Reducer func(state Store, event Event) error
+
+// Reducers by event type
+type Reducers map[string]Reducer
+
+// EventLog append only event storage
+type EventLog interface {
+	// Append fails with ErrVersionConflict unless event.Sequence is greater than the last one
+	Append(event Event) error
+	// Events returns the events with a sequence greater than after, in order
+	Events(after uint64) ([]Event, error)
+}
+
+// MemoryEventLog keeps events in memory
+type MemoryEventLog struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+// checkSequence returns ErrVersionConflict unless sequence follows last
+func checkSequence(sequence uint64, last uint64) error {
+	if sequence <= last {
+		return ErrVersionConflict.Wrap(fmt.Errorf("event %d after %d", sequence, last))
+	}
+	return nil
+}
+
+// Append implements EventLog.Append
+func (log *MemoryEventLog) Append(event Event) error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	last := uint64(0)
+	if len(log.events) > 0 {
+		last = log.events[len(log.events)-1].Sequence
+	}
+	if e := checkSequence(event.Sequence, last); e != nil {
+		return e
+	}
+	log.events = append(log.events, event)
+	return nil
+}
+
+// Events implements EventLog.Events
+func (log *MemoryEventLog) Events(after uint64) ([]Event, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	events := make([]Event, 0)
+	for _, event := range log.events {
+		if event.Sequence > after {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// FileEventLog appends events to a file as JSON lines, a file should be open by one FileEventLog at a time
+type FileEventLog struct {
+	mutex sync.Mutex
+	file  *os.File
+	path  string
+	// last sequence in the file
+	last uint64
+}
+
+// OpenFileEventLog opens path for appending, creating it
+func OpenFileEventLog(path string) (*FileEventLog, error) {
+	file, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if e != nil {
+		return nil, e
+	}
+	log := &FileEventLog{file: file, path: path}
+	events, e := log.Events(0)
+	if e != nil {
+		file.Close()
+		return nil, e
+	}
+	if len(events) > 0 {
+		log.last = events[len(events)-1].Sequence
+	}
+	return log, nil
+}
+
+// Append implements EventLog.Append, synced to disk
+func (log *FileEventLog) Append(event Event) error {
+	line, e := json.Marshal(event)
+	if e != nil {
+		return e
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if e = checkSequence(event.Sequence, log.last); e != nil {
+		return e
+	}
+	if _, e = log.file.Write(append(line, '\n')); e != nil {
+		return e
+	}
+	log.last = event.Sequence
+	return log.file.Sync()
+}
+
+// Events implements EventLog.Events
+func (log *FileEventLog) Events(after uint64) ([]Event, error) {
+	data, e := ioutil.ReadFile(log.path)
+	if e != nil {
+		return nil, e
+	}
+	events := make([]Event, 0)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var event Event
+		if e := decoder.Decode(&event); e != nil {
+			return nil, e
+		}
+		if event.Sequence > after {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Close closes the file
+func (log *FileEventLog) Close() error {
+	return log.file.Close()
+}
+
+// ProjectionSnapshot the state of a projection after an event, see EventStore.Snapshot
+type ProjectionSnapshot struct {
+	Sequence uint64          `json:"sequence"`
+	State    json.RawMessage `json:"state"`
+}
+
+// Replay applies to state the events of log after sequence after with reducers,
+// returns the sequence of the last event applied. ErrUnknownEvent stops it
+func Replay(log EventLog, after uint64, state Store, reducers Reducers) (uint64, error) {
+	events, e := log.Events(after)
+	if e != nil {
+		return after, e
+	}
+	for _, event := range events {
+		reducer, ok := reducers[event.Type]
+		if !ok {
+			return after, ErrUnknownEvent.Wrap(fmt.Errorf("event %d %q", event.Sequence, event.Type))
+		}
+		if e := reducer(state, event); e != nil {
+			return after, e
+		}
+		after = event.Sequence
+	}
+	return after, nil
+}
+
+// EventStore keeps a Store as the projection of an event log,
+// state changes only by Emit, reducers registered per event type apply events to it.
+// Reducers should validate events before mutating state, a failing reducer rejects the event
+// but its partial changes stay until Rebuild
+type EventStore struct {
+	log      EventLog
+	state    Store
+	reducers Reducers
+	// Clock time source, nil means time.Now
+	Clock Clock
+
+	mutex    sync.Mutex
+	sequence uint64
+	// replayed the log was replayed without errors, Emit needs it
+	replayed bool
+}
+
+// NewEventStore projects log into state, call Rebuild or RestoreSnapshot to apply the events
+// already logged, Emit fails with ErrNotReplayed until then
+func NewEventStore(log EventLog, state Store) *EventStore {
+	return &EventStore{log: log, state: state, reducers: make(Reducers)}
+}
+
+// Register sets the reducer of eventType
+func (s *EventStore) Register(eventType string, reducer Reducer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reducers[eventType] = reducer
+}
+
+// Reducers returns a copy of the registered reducers
+func (s *EventStore) Reducers() Reducers {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reducers := make(Reducers, len(s.reducers))
+	for eventType, reducer := range s.reducers {
+		reducers[eventType] = reducer
+	}
+	return reducers
+}
+
+// State returns a read only view of the projection
+func (s *EventStore) State() Store {
+	return ReadOnly(s.state)
+}
+
+// Sequence of the last event applied
+func (s *EventStore) Sequence() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sequence
+}
+
+// Emit applies an event of eventType carrying data, json encoded, then appends it to the log.
+// If the log fails the projection is rebuilt, ErrVersionConflict means another EventStore
+// appended to the log first, the rebuilt projection includes its events
+func (s *EventStore) Emit(eventType string, data interface{}) (Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.replayed {
+		return Event{}, ErrNotReplayed
+	}
+	event := Event{Sequence: s.sequence + 1, Type: eventType, Time: s.Clock.Now()}
+	reducer, ok := s.reducers[eventType]
+	if !ok {
+		return event, ErrUnknownEvent.Wrap(fmt.Errorf("%q", eventType))
+	}
+	if data != nil {
+		raw, e := json.Marshal(data)
+		if e != nil {
+			return event, e
+		}
+		event.Data = raw
+	}
+	if e := reducer(s.state, event); e != nil {
+		return event, e
+	}
+	if e := s.log.Append(event); e != nil {
+		s.rebuild()
+		return event, e
+	}
+	s.sequence = event.Sequence
+	return event, nil
+}
+
+// Rebuild clears the projection and replays the whole log
+func (s *EventStore) Rebuild() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rebuild()
+}
+
+// rebuild caller holds the lock
+func (s *EventStore) rebuild() error {
+	s.state.Clear()
+	sequence, e := Replay(s.log, 0, s.state, s.reducers)
+	s.sequence = sequence
+	s.replayed = e == nil
+	return e
+}
+
+// Snapshot returns the projection saved by SaveJson with the sequence it reflects
+func (s *EventStore) Snapshot() (ProjectionSnapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, e := SaveJson(s.state)
+	if e != nil {
+		return ProjectionSnapshot{}, e
+	}
+	return ProjectionSnapshot{Sequence: s.sequence, State: state}, nil
+}
+
+// RestoreSnapshot loads snapshot into the projection, like LoadJson, then replays the events logged after it
+func (s *EventStore) RestoreSnapshot(snapshot ProjectionSnapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := LoadJson(s.state, snapshot.State); e != nil {
+		return e
+	}
+	s.sequence = snapshot.Sequence
+	sequence, e := Replay(s.log, snapshot.Sequence, s.state, s.reducers)
+	s.sequence = sequence
+	s.replayed = e == nil
+	return e
+}
+
+// Project replays the whole log into a new projection state, reducers override the registered ones,
+// returns an EventStore sharing the log, to try changed reducers without touching this projection
+func (s *EventStore) Project(state Store, reducers Reducers) (*EventStore, error) {
+	projection := NewEventStore(s.log, state)
+	projection.Clock = s.Clock
+	projection.reducers = s.Reducers()
+	for eventType, reducer := range reducers {
+		projection.reducers[eventType] = reducer
+	}
+	return projection, projection.Rebuild()
+}
@@ -0,0 +1,200 @@
+package tinystore_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+type userCreated struct {
+	Username string
+	Password string
+}
+
+type passwordChanged struct {
+	Username string
+	Password string
+}
+
+func userEvents(log tinystore.EventLog, state tinystore.Store) *tinystore.EventStore {
+	events := tinystore.NewEventStore(log, state)
+	events.Register("UserCreated", func(state tinystore.Store, event tinystore.Event) error {
+		var data userCreated
+		if e := event.Decode(&data); e != nil {
+			return e
+		}
+		return state.Add(&DumyyItem{data.Username, data.Password})
+	})
+	events.Register("PasswordChanged", func(state tinystore.Store, event tinystore.Event) error {
+		var data passwordChanged
+		if e := event.Decode(&data); e != nil {
+			return e
+		}
+		if _, e := tinystore.FindByKey(state, data.Username); e != nil {
+			return e
+		}
+		return state.ForEachWhere(NameFilter(data.Username), func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+			return &DumyyItem{data.Username, data.Password}, nil
+		})
+	})
+	return events
+}
+
+// Test_EventStore
+func Test_EventStore(t *testing.T) {
+
+	log := &tinystore.MemoryEventLog{}
+	events := userEvents(log, &tinystore.SimpleStore{})
+
+	if _, e := events.Emit("UserCreated", userCreated{"me", "1234"}); e != tinystore.ErrNotReplayed {
+		t.Error("Should replay the log first")
+		return
+	}
+	events.Rebuild()
+	events.Emit("UserCreated", userCreated{"me", "1234"})
+	events.Emit("UserCreated", userCreated{"you", "abcd"})
+	if _, e := events.Emit("PasswordChanged", passwordChanged{"me", "5678"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if _, e := events.Emit("PasswordChanged", passwordChanged{"nobody", "x"}); e != tinystore.ErrNotFound {
+		t.Error("Reducer should reject the event")
+		return
+	}
+	if _, e := events.Emit("UserDeleted", nil); !errors.Is(e, tinystore.ErrUnknownEvent) {
+		t.Error("Should not emit unknown events")
+		return
+	}
+	if logged, _ := log.Events(0); len(logged) != 3 || events.Sequence() != 3 {
+		t.Errorf("Only accepted events should be logged: %+v", logged)
+		return
+	}
+
+	state := events.State()
+	if item, e := tinystore.FindByKey(state, "me"); e != nil || item.(*DumyyItem).Password != "5678" {
+		t.Error("Should project the events")
+		return
+	}
+	if e := state.Add(&DumyyItem{"x", "y"}); e != tinystore.ErrReadOnly {
+		t.Error("State should be read only")
+		return
+	}
+
+	if e := events.Rebuild(); e != nil || tinystore.Length(state) != 2 {
+		t.Errorf("Should rebuild: %v", e)
+		return
+	}
+
+	// a changed reducer, into a new projection
+	upper := &tinystore.SimpleStore{}
+	projection, e := events.Project(upper, tinystore.Reducers{
+		"UserCreated": func(state tinystore.Store, event tinystore.Event) error {
+			var data userCreated
+			event.Decode(&data)
+			return state.Add(&DumyyItem{data.Username, strings.ToUpper(data.Password)})
+		},
+	})
+	if e != nil || tinystore.Length(upper) != 2 || projection.Sequence() != 3 {
+		t.Errorf("Should project: %v", e)
+		return
+	}
+	if item, _ := tinystore.FindByKey(upper, "you"); item.(*DumyyItem).Password != "ABCD" {
+		t.Error("Should use the new reducer")
+		return
+	}
+	if item, _ := tinystore.FindByKey(state, "you"); item.(*DumyyItem).Password != "abcd" {
+		t.Error("Original projection should not change")
+		return
+	}
+}
+
+// Test_EventStore_Snapshot
+func Test_EventStore_Snapshot(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "events.log")
+	log, e := tinystore.OpenFileEventLog(path)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	defer log.Close()
+
+	state := &tinystore.SimpleStore{Name: "Users"}
+	tinystore.RegisterStoreAdapter(state, tinystore.NewDefaultStoreItemAdapter(convert))
+	events := userEvents(log, state)
+	events.Rebuild()
+	events.Emit("UserCreated", userCreated{"me", "1234"})
+	snapshot, e := events.Snapshot()
+	if e != nil || snapshot.Sequence != 1 {
+		t.Errorf("Should snapshot: %v", e)
+		return
+	}
+	events.Emit("PasswordChanged", passwordChanged{"me", "5678"})
+	events.Emit("UserCreated", userCreated{"you", "abcd"})
+
+	// reopened from the file
+	restored := userEvents(log, state)
+	state.Clear()
+	if e := restored.RestoreSnapshot(snapshot); e != nil {
+		t.Error(e)
+		return
+	}
+	if restored.Sequence() != 3 || tinystore.Length(state) != 2 {
+		t.Errorf("Should replay after the snapshot, sequence %d", restored.Sequence())
+		return
+	}
+	if item, _ := tinystore.FindByKey(state, "me"); item.(*DumyyItem).Password != "5678" {
+		t.Error("Should apply events after the snapshot")
+		return
+	}
+
+	if _, e := tinystore.Replay(log, 0, &tinystore.SimpleStore{}, tinystore.Reducers{}); !errors.Is(e, tinystore.ErrUnknownEvent) {
+		t.Errorf("Replay without reducers should fail: %v", e)
+		return
+	}
+
+	// reopened file keeps its sequence
+	reopened, e := tinystore.OpenFileEventLog(path)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	defer reopened.Close()
+	if e := reopened.Append(tinystore.Event{Sequence: 3, Type: "UserCreated"}); !errors.Is(e, tinystore.ErrVersionConflict) {
+		t.Errorf("Should reject a logged sequence: %v", e)
+		return
+	}
+}
+
+// Test_EventStore_SharedLog
+func Test_EventStore_SharedLog(t *testing.T) {
+
+	log := &tinystore.MemoryEventLog{}
+	first := userEvents(log, &tinystore.SimpleStore{})
+	second := userEvents(log, &tinystore.SimpleStore{})
+	first.Rebuild()
+	second.Rebuild()
+
+	if _, e := first.Emit("UserCreated", userCreated{"me", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if _, e := second.Emit("UserCreated", userCreated{"you", "abcd"}); !errors.Is(e, tinystore.ErrVersionConflict) {
+		t.Errorf("Should not reuse a sequence: %v", e)
+		return
+	}
+	if second.Sequence() != 1 || tinystore.Length(second.State()) != 1 {
+		t.Error("Should catch up with the log")
+		return
+	}
+	if event, e := second.Emit("UserCreated", userCreated{"you", "abcd"}); e != nil || event.Sequence != 2 {
+		t.Errorf("Should emit after catching up: %v", e)
+		return
+	}
+	if logged, _ := log.Events(0); len(logged) != 2 || logged[1].Sequence != 2 {
+		t.Errorf("Bad log: %+v", logged)
+		return
+	}
+}
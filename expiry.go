@@ -0,0 +1,268 @@
+package tinystore
+
+import (
+	"sync"
+	"time"
+)
+
+// Expirer is implemented by items carrying their own deadline, a zero time never expires
+type Expirer interface {
+	ExpiresAt() time.Time
+}
+
+// ExpiryEvent sent to watchers for each expired item
+type ExpiryEvent struct {
+	Item StoreItem
+	// Deadline the item had
+	Deadline time.Time
+	// ExpiredAt time the item was removed
+	ExpiredAt time.Time
+}
+
+// ExpiryOptions configures an ExpiringStore, zero values disable each feature
+type ExpiryOptions struct {
+	// DefaultTTL applied by Add to items that are not Expirer
+	DefaultTTL time.Duration
+	// SweepInterval period of the background sweeper
+	SweepInterval time.Duration
+	// Clock time source, nil means time.Now
+	Clock Clock
+}
+
+// ExpiringStore wraps a Store removing items once their deadline passes,
+// expired items are removed lazily before every read and by an optional background sweeper.
+// Call Close to stop the sweeper
+type ExpiringStore struct {
+	store   Store
+	options ExpiryOptions
+
+	mutex     sync.Mutex
+	deadlines map[interface{}]time.Time
+	watchers  []func(ExpiryEvent)
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewExpiringStore wraps store, starts the sweeper if options.SweepInterval > 0.
+// Items already in store are not tracked
+func NewExpiringStore(store Store, options ExpiryOptions) *ExpiringStore {
+	expiring := &ExpiringStore{
+		store:     store,
+		options:   options,
+		deadlines: make(map[interface{}]time.Time),
+		done:      make(chan struct{}),
+	}
+	if options.SweepInterval > 0 {
+		go expiring.sweeper(options.SweepInterval)
+	}
+	return expiring
+}
+
+func (s *ExpiringStore) sweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the background sweeper
+func (s *ExpiringStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// Watch registers f to be called, outside the store lock, for every expired item
+func (s *ExpiringStore) Watch(f func(ExpiryEvent)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.watchers = append(s.watchers, f)
+}
+
+// deadlineOf returns the item own deadline or now + ttl, zero if none
+func (s *ExpiringStore) deadlineOf(item StoreItem, ttl time.Duration) time.Time {
+	if expirer, ok := item.(Expirer); ok {
+		return expirer.ExpiresAt()
+	}
+	if ttl > 0 {
+		return s.options.Clock.Now().Add(ttl)
+	}
+	return time.Time{}
+}
+
+// track records item deadline, caller holds the lock
+func (s *ExpiringStore) track(key interface{}, deadline time.Time) {
+	if deadline.IsZero() {
+		delete(s.deadlines, key)
+		return
+	}
+	s.deadlines[key] = deadline
+}
+
+// Sweep removes expired items now, returns how many were removed
+func (s *ExpiringStore) Sweep() int {
+	s.mutex.Lock()
+	now := s.options.Clock.Now()
+	expired := make(map[interface{}]time.Time)
+	for key, deadline := range s.deadlines {
+		if !deadline.After(now) {
+			expired[key] = deadline
+		}
+	}
+	if len(expired) == 0 {
+		s.mutex.Unlock()
+		return 0
+	}
+	isExpired := func(item StoreItem) bool {
+		_, ok := expired[item.GetKey()]
+		return ok
+	}
+	items, _ := Where(s.store, isExpired)
+	s.store.RemoveWhere(isExpired)
+	for key := range expired {
+		delete(s.deadlines, key)
+	}
+	watchers := append([]func(ExpiryEvent){}, s.watchers...)
+	s.mutex.Unlock()
+
+	for _, item := range items {
+		event := ExpiryEvent{Item: item, Deadline: expired[item.GetKey()], ExpiredAt: now}
+		for _, watcher := range watchers {
+			watcher(event)
+		}
+	}
+	return len(items)
+}
+
+// AddWithTTL adds item expiring after ttl, ttl <= 0 never expires
+func (s *ExpiringStore) AddWithTTL(item StoreItem, ttl time.Duration) error {
+	s.Sweep()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.store.Add(item); e != nil {
+		return e
+	}
+	if ttl > 0 {
+		s.track(item.GetKey(), s.options.Clock.Now().Add(ttl))
+	} else {
+		s.track(item.GetKey(), time.Time{})
+	}
+	return nil
+}
+
+// Expire sets the deadline of the item matching key, a zero deadline never expires
+func (s *ExpiringStore) Expire(key interface{}, deadline time.Time) error {
+	s.Sweep()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, e := FindByKey(s.store, key); e != nil {
+		return e
+	}
+	s.track(key, deadline)
+	return nil
+}
+
+// Deadline of the item matching key, zero if it never expires
+func (s *ExpiringStore) Deadline(key interface{}) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.deadlines[key]
+}
+
+// GetName implements Store.GetName
+func (s *ExpiringStore) GetName() string {
+	return s.store.GetName()
+}
+
+// All implements Store.All
+func (s *ExpiringStore) All() []StoreItem {
+	s.Sweep()
+	return s.store.All()
+}
+
+// Find implements Store.Find
+func (s *ExpiringStore) Find(filter Filter) (StoreItem, error) {
+	s.Sweep()
+	return s.store.Find(filter)
+}
+
+// Add implements Store.Add, the item expires at its ExpiresAt if it is an Expirer or after DefaultTTL
+func (s *ExpiringStore) Add(item StoreItem) error {
+	s.Sweep()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.store.Add(item); e != nil {
+		return e
+	}
+	s.track(item.GetKey(), s.deadlineOf(item, s.options.DefaultTTL))
+	return nil
+}
+
+// Load implements Store.Load, only Expirer items get a deadline
+func (s *ExpiringStore) Load(items ...StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.store.Load(items...); e != nil {
+		return e
+	}
+	s.deadlines = make(map[interface{}]time.Time)
+	for _, item := range items {
+		s.track(item.GetKey(), s.deadlineOf(item, 0))
+	}
+	return nil
+}
+
+// Remove implements Store.Remove
+func (s *ExpiringStore) Remove(item StoreItem) error {
+	s.Sweep()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.store.Remove(item); e != nil {
+		return e
+	}
+	delete(s.deadlines, item.GetKey())
+	return nil
+}
+
+// Clear implements Store.Clear
+func (s *ExpiringStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store.Clear()
+	s.deadlines = make(map[interface{}]time.Time)
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *ExpiringStore) RemoveWhere(filter Filter) error {
+	s.Sweep()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	removed, _ := Where(s.store, filter)
+	if e := s.store.RemoveWhere(filter); e != nil {
+		return e
+	}
+	for _, item := range removed {
+		delete(s.deadlines, item.GetKey())
+	}
+	return nil
+}
+
+// ForEach implements Store.ForEach
+func (s *ExpiringStore) ForEach(f Mutator) error {
+	s.Sweep()
+	return s.store.ForEach(f)
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (s *ExpiringStore) ForEachWhere(filter Filter, transform Mutator) error {
+	s.Sweep()
+	return s.store.ForEachWhere(filter, transform)
+}
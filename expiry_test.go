@@ -0,0 +1,111 @@
+package tinystore_test
+
+import (
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+// expiringItem implements tinystore.Expirer
+type expiringItem struct {
+	DumyyItem
+	Deadline time.Time
+}
+
+func (this *expiringItem) ExpiresAt() time.Time {
+	return this.Deadline
+}
+
+// Test_ExpiringStore
+func Test_ExpiringStore(t *testing.T) {
+
+	clock, advance := fakeClock()
+	store := tinystore.NewExpiringStore(&tinystore.SimpleStore{}, tinystore.ExpiryOptions{
+		DefaultTTL: time.Hour,
+		Clock:      clock,
+	})
+	defer store.Close()
+
+	expired := make([]tinystore.ExpiryEvent, 0)
+	store.Watch(func(event tinystore.ExpiryEvent) {
+		expired = append(expired, event)
+	})
+
+	store.Add(&DumyyItem{"session", "1234"})
+	store.AddWithTTL(&DumyyItem{"otp", "1234"}, time.Minute)
+	store.AddWithTTL(&DumyyItem{"admin", "1234"}, 0)
+	store.Add(&expiringItem{DumyyItem{"token", "1234"}, clock.Now().Add(2 * time.Hour)})
+
+	if tinystore.Length(store) != 4 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+
+	advance(2 * time.Minute)
+	if _, e := tinystore.FindByKey(store, "otp"); e != tinystore.ErrNotFound {
+		t.Error("otp should be expired")
+		return
+	}
+	if len(expired) != 1 || expired[0].Item.GetKey() != "otp" {
+		t.Errorf("Bad events: %v", expired)
+		return
+	}
+
+	advance(time.Hour)
+	if tinystore.Length(store) != 2 {
+		t.Errorf("session should be expired, Length: %v", tinystore.Length(store))
+		return
+	}
+
+	advance(time.Hour)
+	if tinystore.Length(store) != 1 || len(expired) != 3 {
+		t.Error("token should be expired")
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "admin"); e != nil {
+		t.Error("admin never expires")
+	}
+
+	if e := store.Expire("admin", clock.Now().Add(time.Minute)); e != nil {
+		t.Error(e)
+		return
+	}
+	advance(time.Minute)
+	if tinystore.Length(store) != 0 {
+		t.Error("admin should be expired")
+	}
+}
+
+// Test_ExpiringStore_Sweeper
+func Test_ExpiringStore_Sweeper(t *testing.T) {
+
+	clock, advance := fakeClock()
+	inner := &tinystore.SimpleStore{}
+	store := tinystore.NewExpiringStore(inner, tinystore.ExpiryOptions{
+		SweepInterval: time.Millisecond,
+		Clock:         clock,
+	})
+	defer store.Close()
+
+	events := make(chan tinystore.ExpiryEvent, 1)
+	store.Watch(func(event tinystore.ExpiryEvent) {
+		events <- event
+	})
+
+	store.AddWithTTL(&DumyyItem{"otp", "1234"}, time.Minute)
+	advance(time.Minute)
+
+	select {
+	case event := <-events:
+		if event.Item.GetKey() != "otp" {
+			t.Errorf("Bad event: %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("Sweeper didn't run")
+		return
+	}
+	// removed from the wrapped store without reads through the wrapper
+	if tinystore.Length(inner) != 0 {
+		t.Error("Not removed")
+	}
+}
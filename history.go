@@ -0,0 +1,174 @@
+package tinystore
+
+import (
+	"sort"
+	"time"
+)
+
+// Cloner is implemented by items able to copy themselves,
+// history keeps clones so mutators changing items in place don't rewrite the past
+type Cloner interface {
+	Clone() StoreItem
+}
+
+// RetentionPolicy limits the history kept per key, zero values keep everything,
+// the latest version of each key is always kept
+type RetentionPolicy struct {
+	// MaxAge versions older than this are dropped
+	MaxAge time.Duration
+	// MaxVersions versions kept per key
+	MaxVersions int
+}
+
+// ItemVersion an item as it was at a revision
+type ItemVersion struct {
+	Key interface{}
+	// Item nil if Removed
+	Item     StoreItem
+	Revision uint64
+	Time     time.Time
+	Removed  bool
+}
+
+type history struct {
+	policy   RetentionPolicy
+	versions map[interface{}][]ItemVersion
+}
+
+// record appends a version of key, caller holds the store lock
+func (h *history) record(key interface{}, item StoreItem, revision uint64, now time.Time) {
+	if cloner, ok := item.(Cloner); ok {
+		item = cloner.Clone()
+	}
+	h.versions[key] = append(h.versions[key], ItemVersion{
+		Key:      key,
+		Item:     item,
+		Revision: revision,
+		Time:     now,
+		Removed:  item == nil,
+	})
+	h.prune(key, now)
+}
+
+// prune applies the retention policy to key versions
+func (h *history) prune(key interface{}, now time.Time) {
+	versions := h.versions[key]
+	drop := 0
+	if h.policy.MaxVersions > 0 && len(versions) > h.policy.MaxVersions {
+		drop = len(versions) - h.policy.MaxVersions
+	}
+	if h.policy.MaxAge > 0 {
+		for drop < len(versions)-1 && now.Sub(versions[drop].Time) > h.policy.MaxAge {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+	// the only version left of a removed key is useless
+	if drop == len(versions)-1 && versions[drop].Removed && h.policy.MaxAge > 0 && now.Sub(versions[drop].Time) > h.policy.MaxAge {
+		delete(h.versions, key)
+		return
+	}
+	h.versions[key] = append([]ItemVersion(nil), versions[drop:]...)
+}
+
+// asOf returns the latest version of each key accepted by match, ordered by revision then key
+func (h *history) asOf(match func(version ItemVersion) bool) ([]StoreItem, uint64) {
+	found := make([]ItemVersion, 0)
+	var revision uint64
+	for _, versions := range h.versions {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if match(versions[i]) {
+				if versions[i].Revision > revision {
+					revision = versions[i].Revision
+				}
+				if !versions[i].Removed {
+					found = append(found, versions[i])
+				}
+				break
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Revision == found[j].Revision {
+			return keyString(found[i].Item.GetKey()) < keyString(found[j].Item.GetKey())
+		}
+		return found[i].Revision < found[j].Revision
+	})
+	items := make([]StoreItem, len(found))
+	for i, version := range found {
+		items[i] = version.Item
+	}
+	return items, revision
+}
+
+// EnableHistory starts keeping every version of every item, pruned by policy,
+// current items are recorded as their first version
+func (store *SimpleStore) EnableHistory(policy RetentionPolicy) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.history != nil {
+		store.history.policy = policy
+		return
+	}
+	store.history = &history{policy: policy, versions: make(map[interface{}][]ItemVersion)}
+	now := store.Clock.Now()
+	for _, x := range store.load() {
+		store.history.record(x.GetKey(), x, store.versions[x.GetKey()], now)
+	}
+}
+
+// History returns every kept version of key, oldest first
+func (store *SimpleStore) History(key interface{}) ([]ItemVersion, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	versions, ok := store.history.versions[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]ItemVersion(nil), versions...), nil
+}
+
+// AsOf returns a read only Store with the items as they were at revision
+func (store *SimpleStore) AsOf(revision uint64) (Store, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	items, _ := store.history.asOf(func(version ItemVersion) bool {
+		return version.Revision <= revision
+	})
+	return &SnapshotStore{items: items, revision: revision, name: store.Name}, nil
+}
+
+// AsOfTime returns a read only Store with the items as they were at t
+func (store *SimpleStore) AsOfTime(t time.Time) (Store, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	items, revision := store.history.asOf(func(version ItemVersion) bool {
+		return !version.Time.After(t)
+	})
+	return &SnapshotStore{items: items, revision: revision, name: store.Name}, nil
+}
+
+// PruneHistory applies the retention policy to every key,
+// age based retention only runs when a key changes, call this periodically
+func (store *SimpleStore) PruneHistory() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.history == nil {
+		return
+	}
+	now := store.Clock.Now()
+	for key := range store.history.versions {
+		store.history.prune(key, now)
+	}
+}
@@ -0,0 +1,144 @@
+package tinystore_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+// Clone implements tinystore.Cloner
+func (this *DumyyItem) Clone() tinystore.StoreItem {
+	clone := *this
+	return &clone
+}
+
+// fakeClock returns a clock and a func to move it forward, safe for concurrent use
+func fakeClock() (tinystore.Clock, func(d time.Duration)) {
+	mutex := sync.Mutex{}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	return clock, advance
+}
+
+// Test_History
+func Test_History(t *testing.T) {
+
+	clock, advance := fakeClock()
+	store := &tinystore.SimpleStore{Clock: clock}
+
+	if _, e := store.History("me"); e != tinystore.ErrHistoryDisabled {
+		t.Error("Should be disabled")
+		return
+	}
+
+	store.Add(&DumyyItem{"me", "1234"})
+	store.EnableHistory(tinystore.RetentionPolicy{})
+
+	start := clock.Now()
+	advance(time.Hour)
+	store.Add(&DumyyItem{"you", "1234"})
+	middle := store.Revision()
+	advance(time.Hour)
+	// in place mutation, the clone keeps the past
+	store.ForEachWhere(NameFilter("me"), reversePassword)
+	advance(time.Hour)
+	store.Remove(&DumyyItem{"you", "1234"})
+
+	versions, e := store.History("me")
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if len(versions) != 2 || AsCredential(versions[0].Item).Password != "1234" || AsCredential(versions[1].Item).Password != "4321" {
+		t.Errorf("Bad history: %v", versions)
+		return
+	}
+	if versions, _ := store.History("you"); len(versions) != 2 || !versions[1].Removed {
+		t.Errorf("Bad history: %v", versions)
+		return
+	}
+
+	past, e := store.AsOf(middle)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(past) != 2 {
+		t.Errorf("Bad Length: %v", tinystore.Length(past))
+		return
+	}
+	if x, _ := tinystore.FindByKey(past, "me"); AsCredential(x).Password != "1234" {
+		t.Error("Bad past")
+	}
+
+	past, _ = store.AsOfTime(start)
+	if tinystore.Length(past) != 1 {
+		t.Errorf("Bad Length: %v", tinystore.Length(past))
+	}
+	if e := past.Add(&DumyyItem{"el", "1234"}); e != tinystore.ErrReadOnly {
+		t.Error("Should be read only")
+	}
+
+	now, _ := store.AsOfTime(clock.Now())
+	if tinystore.Length(now) != 1 {
+		t.Errorf("Bad Length: %v", tinystore.Length(now))
+	}
+}
+
+// Test_History_Retention
+func Test_History_Retention(t *testing.T) {
+
+	clock, advance := fakeClock()
+	store := &tinystore.SimpleStore{Clock: clock}
+	store.EnableHistory(tinystore.RetentionPolicy{MaxVersions: 3})
+
+	store.Add(&DumyyItem{"me", "0"})
+	for _, password := range []string{"1", "2", "3", "4"} {
+		store.Upsert(&DumyyItem{"me", password})
+	}
+	if versions, _ := store.History("me"); len(versions) != 3 || AsCredential(versions[0].Item).Password != "2" {
+		t.Errorf("Bad history: %v", versions)
+		return
+	}
+
+	store.EnableHistory(tinystore.RetentionPolicy{MaxAge: time.Hour})
+	advance(2 * time.Hour)
+	store.PruneHistory()
+	if versions, _ := store.History("me"); len(versions) != 1 || AsCredential(versions[0].Item).Password != "4" {
+		t.Errorf("Latest version should be kept: %v", versions)
+	}
+}
+
+// Test_History_Order items of one revision come back by key
+func Test_History_Order(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.EnableHistory(tinystore.RetentionPolicy{})
+	store.Load(&DumyyItem{"e", "1"}, &DumyyItem{"c", "1"}, &DumyyItem{"a", "1"}, &DumyyItem{"d", "1"}, &DumyyItem{"b", "1"})
+
+	for i := 0; i < 10; i++ {
+		past, e := store.AsOf(store.Revision())
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		keys := ""
+		for _, item := range past.All() {
+			keys += item.GetKey().(string)
+		}
+		if keys != "abcde" {
+			t.Errorf("Should order by key: %s", keys)
+			return
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package tinystore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// integrityAlgorithm leaves are sha256 of the key and the canonical json of the item,
+// nodes sha256 of their children, an odd node is promoted as is
+const integrityAlgorithm = "sha256-merkle"
+
+// Integrity checksums SaveJson stores with the items, hex encoded.
+// They are plain sha256 and only detect accidental corruption, anyone editing the file
+// can recompute them, unless SetIntegrityKey was called
+type Integrity struct {
+	Algorithm string            `json:"algorithm"`
+	Root      string            `json:"root"`
+	Leaves    map[string]string `json:"leaves"`
+	// MAC hmac-sha256 of Root with the integrity key, empty without one
+	MAC string `json:"mac,omitempty"`
+}
+
+var integrityKey struct {
+	sync.RWMutex
+	key []byte
+}
+
+// SetIntegrityKey sets the key SaveJson authenticates checksums with, an empty key removes it.
+// With a key set LoadJson rejects plain arrays and files whose MAC is missing or doesn't verify
+func SetIntegrityKey(key []byte) {
+	integrityKey.Lock()
+	defer integrityKey.Unlock()
+	integrityKey.key = append([]byte(nil), key...)
+}
+
+// integrityMAC returns the hex MAC of root, "" if no key is set
+func integrityMAC(root []byte) string {
+	integrityKey.RLock()
+	defer integrityKey.RUnlock()
+	if len(integrityKey.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, integrityKey.key)
+	mac.Write(root)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// integrityFile SaveJson format, LoadJson also reads plain arrays
+type integrityFile struct {
+	Integrity *Integrity    `json:"integrity"`
+	Items     []interface{} `json:"items"`
+}
+
+// MerkleTree over item hashes sorted by key, keys are compared in their fmt.Sprint form
+type MerkleTree struct {
+	keys   []string
+	index  map[string]int
+	levels [][][]byte
+}
+
+// BuildMerkleTree hashes the items of store, secrets are hashed as stored.
+// Two stores holding the same items have the same Root. Files hash their documents as saved,
+// with secrets sealed by random nonces, so a file root differs from its store root
+func BuildMerkleTree(store Store) (*MerkleTree, error) {
+	leaves := make(map[string][]byte)
+	for _, item := range store.All() {
+		doc, e := document(item, rawSecrets, nil)
+		if e != nil {
+			return nil, e
+		}
+		key := keyString(item.GetKey())
+		if leaves[key], e = leafHash(key, doc); e != nil {
+			return nil, e
+		}
+	}
+	return newMerkleTree(leaves), nil
+}
+
+func keyString(key interface{}) string {
+	return fmt.Sprint(key)
+}
+
+// canonical json of doc, object keys sorted and numbers normalized
+func canonical(doc interface{}) ([]byte, error) {
+	raw, e := json.Marshal(doc)
+	if e != nil {
+		return nil, e
+	}
+	var value interface{}
+	if e = json.Unmarshal(raw, &value); e != nil {
+		return nil, e
+	}
+	return json.Marshal(value)
+}
+
+func leafHash(key string, doc interface{}) ([]byte, error) {
+	raw, e := canonical(doc)
+	if e != nil {
+		return nil, e
+	}
+	hash := sha256.New()
+	hash.Write([]byte{0})
+	binary.Write(hash, binary.BigEndian, uint32(len(key)))
+	hash.Write([]byte(key))
+	hash.Write(raw)
+	return hash.Sum(nil), nil
+}
+
+func nodeHash(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{1})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+func newMerkleTree(leaves map[string][]byte) *MerkleTree {
+	tree := &MerkleTree{keys: make([]string, 0, len(leaves)), index: make(map[string]int)}
+	for key := range leaves {
+		tree.keys = append(tree.keys, key)
+	}
+	sort.Strings(tree.keys)
+	level := make([][]byte, len(tree.keys))
+	for i, key := range tree.keys {
+		tree.index[key] = i
+		level[i] = leaves[key]
+	}
+	tree.levels = append(tree.levels, level)
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, nodeHash(level[i], level[i+1]))
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree
+}
+
+// Root hash of the tree, sha256 of nothing if it's empty
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	return top[0]
+}
+
+// Leaf returns the hash of the item matching key
+func (t *MerkleTree) Leaf(key interface{}) ([]byte, bool) {
+	i, exists := t.index[keyString(key)]
+	if !exists {
+		return nil, false
+	}
+	return t.levels[0][i], true
+}
+
+// ProofStep a sibling hash on the way to the root
+type ProofStep struct {
+	Hash []byte `json:"hash"`
+	// Left the sibling is the left child
+	Left bool `json:"left"`
+}
+
+// MerkleProof shows an item hash is part of a root
+type MerkleProof struct {
+	Key  string      `json:"key"`
+	Leaf []byte      `json:"leaf"`
+	Path []ProofStep `json:"path"`
+}
+
+// Proof returns the proof of the item matching key, ErrNotFound if there is none
+func (t *MerkleTree) Proof(key interface{}) (*MerkleProof, error) {
+	leaf, exists := t.Leaf(key)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	proof := &MerkleProof{Key: keyString(key), Leaf: leaf}
+	i := t.index[proof.Key]
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if i%2 == 1 {
+			proof.Path = append(proof.Path, ProofStep{Hash: level[i-1], Left: true})
+		} else if i+1 < len(level) {
+			proof.Path = append(proof.Path, ProofStep{Hash: level[i+1]})
+		}
+		i /= 2
+	}
+	return proof, nil
+}
+
+// Verify returns true if the proof leads to root
+func (p *MerkleProof) Verify(root []byte) bool {
+	hash := p.Leaf
+	for _, step := range p.Path {
+		if step.Left {
+			hash = nodeHash(step.Hash, hash)
+		} else {
+			hash = nodeHash(hash, step.Hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
+
+// integrityOf returns the checksums of docs, the saved documents of items
+func integrityOf(items []StoreItem, docs []interface{}) (*Integrity, error) {
+	leaves := make(map[string][]byte)
+	hexLeaves := make(map[string]string)
+	for i, item := range items {
+		key := keyString(item.GetKey())
+		if _, exists := leaves[key]; exists {
+			return nil, ErrIntegrity.Wrap(fmt.Errorf("%q duplicated", key))
+		}
+		leaf, e := leafHash(key, docs[i])
+		if e != nil {
+			return nil, e
+		}
+		leaves[key] = leaf
+		hexLeaves[key] = hex.EncodeToString(leaf)
+	}
+	root := newMerkleTree(leaves).Root()
+	return &Integrity{Algorithm: integrityAlgorithm, Root: hex.EncodeToString(root), Leaves: hexLeaves, MAC: integrityMAC(root)}, nil
+}
+
+// parseDocuments reads a SaveJson file or a plain array, integrity is nil for arrays
+func parseDocuments(data []byte) ([]map[string]interface{}, *Integrity, error) {
+	docs := make([]map[string]interface{}, 0)
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		e := json.Unmarshal(data, &docs)
+		return docs, nil, e
+	}
+	file := struct {
+		Integrity *Integrity               `json:"integrity"`
+		Items     []map[string]interface{} `json:"items"`
+	}{}
+	if e := json.Unmarshal(data, &file); e != nil {
+		return nil, nil, e
+	}
+	if file.Integrity == nil {
+		return nil, nil, ErrIntegrity.Wrap(fmt.Errorf("no checksums"))
+	}
+	if file.Items != nil {
+		docs = file.Items
+	}
+	return docs, file.Integrity, nil
+}
+
+// canonicalDocuments canonical json of docs as read, before secrets are opened
+func canonicalDocuments(docs []map[string]interface{}) ([][]byte, error) {
+	result := make([][]byte, len(docs))
+	for i, doc := range docs {
+		raw, e := canonical(doc)
+		if e != nil {
+			return nil, e
+		}
+		result[i] = raw
+	}
+	return result, nil
+}
+
+// verify checks the items converted from docs, whose canonical json is raw, against the checksums
+func (integrity *Integrity) verify(items []StoreItem, raw [][]byte) error {
+	if integrity.Algorithm != integrityAlgorithm {
+		return ErrIntegrity.Wrap(fmt.Errorf("unsupported algorithm %q", integrity.Algorithm))
+	}
+	leaves := make(map[string][]byte)
+	problems := make([]string, 0)
+	for i, item := range items {
+		key := keyString(item.GetKey())
+		if _, exists := leaves[key]; exists {
+			problems = append(problems, fmt.Sprintf("%q duplicated", key))
+			continue
+		}
+		leaf, _ := leafHash(key, json.RawMessage(raw[i]))
+		leaves[key] = leaf
+		expected, exists := integrity.Leaves[key]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%q added", key))
+		} else if expected != hex.EncodeToString(leaf) {
+			problems = append(problems, fmt.Sprintf("%q modified", key))
+		}
+	}
+	for key := range integrity.Leaves {
+		if _, exists := leaves[key]; !exists {
+			problems = append(problems, fmt.Sprintf("%q removed", key))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return ErrIntegrity.Wrap(fmt.Errorf("%s", strings.Join(problems, ", ")))
+	}
+	root := newMerkleTree(leaves).Root()
+	if hex.EncodeToString(root) != integrity.Root {
+		return ErrIntegrity.Wrap(fmt.Errorf("root mismatch"))
+	}
+	if mac := integrityMAC(root); mac != "" && !hmac.Equal([]byte(mac), []byte(integrity.MAC)) {
+		return ErrIntegrity.Wrap(fmt.Errorf("mac mismatch"))
+	}
+	return nil
+}
+
+// integrityRequired returns true if an integrity key is set
+func integrityRequired() bool {
+	integrityKey.RLock()
+	defer integrityKey.RUnlock()
+	return len(integrityKey.key) > 0
+}
@@ -0,0 +1,147 @@
+package tinystore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Integrity
+func Test_Integrity(t *testing.T) {
+
+	store := credentialStore(t)
+	saved, e := tinystore.SaveJson(store)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+
+	store.Clear()
+	if e := tinystore.LoadVerifiedJson(store, saved); e != nil || tinystore.Length(store) != 2 {
+		t.Errorf("Should verify: %v", e)
+		return
+	}
+
+	tampered := bytes.Replace(saved, []byte(`"Password": "P@55w0rd!"`), []byte(`"Password": "hacked"`), 1)
+	store.Clear()
+	e = tinystore.LoadJson(store, tampered)
+	if !errors.Is(e, tinystore.ErrIntegrity) || !strings.Contains(e.Error(), `"admin" modified`) {
+		t.Errorf("Should detect the edit: %v", e)
+		return
+	}
+	if tinystore.Length(store) != 0 {
+		t.Error("Nothing should be loaded")
+		return
+	}
+
+	renamed := bytes.Replace(saved, []byte(`"Username": "crypto"`), []byte(`"Username": "root"`), 1)
+	if e := tinystore.LoadJson(store, renamed); !errors.Is(e, tinystore.ErrIntegrity) || !strings.Contains(e.Error(), `"crypto" removed`) {
+		t.Errorf("Should detect the rename: %v", e)
+		return
+	}
+
+	if e := tinystore.LoadVerifiedJsonFile(store, "testdata/credentials.json"); !errors.Is(e, tinystore.ErrIntegrity) {
+		t.Errorf("Plain arrays have no checksums: %v", e)
+		return
+	}
+	if e := tinystore.LoadJsonFile(store, "testdata/credentials.json"); e != nil {
+		t.Errorf("LoadJson should still read plain arrays: %v", e)
+		return
+	}
+}
+
+// Test_MerkleTree
+func Test_MerkleTree(t *testing.T) {
+
+	one := &tinystore.SimpleStore{}
+	one.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"}, &DumyyItem{"c", "3"}, &DumyyItem{"d", "4"}, &DumyyItem{"e", "5"})
+	other := &tinystore.SimpleStore{}
+	other.Load(&DumyyItem{"e", "5"}, &DumyyItem{"d", "4"}, &DumyyItem{"c", "3"}, &DumyyItem{"b", "2"}, &DumyyItem{"a", "1"})
+
+	tree, _ := tinystore.BuildMerkleTree(one)
+	otherTree, _ := tinystore.BuildMerkleTree(other)
+	if !bytes.Equal(tree.Root(), otherTree.Root()) {
+		t.Error("Same items should have the same root")
+		return
+	}
+
+	other.UpdateByKey("c", func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"c", "changed"}, nil
+	})
+	otherTree, _ = tinystore.BuildMerkleTree(other)
+	if bytes.Equal(tree.Root(), otherTree.Root()) {
+		t.Error("Roots should differ")
+		return
+	}
+	a, _ := tree.Leaf("a")
+	otherA, _ := otherTree.Leaf("a")
+	if !bytes.Equal(a, otherA) {
+		t.Error("Unchanged leaves should match")
+		return
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		proof, e := tree.Proof(key)
+		if e != nil || !proof.Verify(tree.Root()) {
+			t.Errorf("Proof of %s failed: %v", key, e)
+			return
+		}
+	}
+	proof, _ := tree.Proof("c")
+	if proof.Verify(otherTree.Root()) {
+		t.Error("Proof should not verify another root")
+		return
+	}
+	if _, e := tree.Proof("x"); e != tinystore.ErrNotFound {
+		t.Error("Should not find x")
+		return
+	}
+}
+
+// Test_IntegrityKey
+func Test_IntegrityKey(t *testing.T) {
+
+	store := credentialStore(t)
+	unkeyed, _ := tinystore.SaveJson(store)
+
+	tinystore.SetIntegrityKey([]byte("integrity key"))
+	defer tinystore.SetIntegrityKey(nil)
+
+	saved, e := tinystore.SaveJson(store)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if e := tinystore.LoadJson(store, saved); e != nil {
+		t.Errorf("Should verify: %v", e)
+		return
+	}
+	if e := tinystore.LoadJsonFile(store, "testdata/credentials.json"); !errors.Is(e, tinystore.ErrIntegrity) {
+		t.Errorf("Should reject plain arrays: %v", e)
+		return
+	}
+	// checksums recomputed by someone without the key
+	if e := tinystore.LoadJson(store, unkeyed); !errors.Is(e, tinystore.ErrIntegrity) {
+		t.Errorf("Should reject unauthenticated checksums: %v", e)
+		return
+	}
+
+	file := struct {
+		Integrity json.RawMessage          `json:"integrity"`
+		Items     []map[string]interface{} `json:"items"`
+	}{}
+	json.Unmarshal(saved, &file)
+	file.Items = append(file.Items, file.Items[0])
+	duplicated, _ := json.Marshal(file)
+	if e := tinystore.LoadJson(store, duplicated); !errors.Is(e, tinystore.ErrIntegrity) || !strings.Contains(e.Error(), "duplicated") {
+		t.Errorf("Should reject duplicates: %v", e)
+		return
+	}
+	if tinystore.Length(store) != 2 {
+		t.Error("Rejected files should not be loaded")
+		return
+	}
+}
@@ -0,0 +1,55 @@
+//go:build go1.23
+
+package tinystore
+
+import (
+	"iter"
+)
+
+// Items returns an iterator over store items.
+// Iteration ranges over the store.All() view taken when it starts, SimpleStore publishes
+// immutable views so nothing is copied and concurrent changes are not seen
+func Items(store Store) iter.Seq[StoreItem] {
+	return Filtered(store, nil)
+}
+
+// Filtered returns an iterator over store items where filter returns true, a nil filter matches every item
+func Filtered(store Store, filter Filter) iter.Seq[StoreItem] {
+	return func(yield func(StoreItem) bool) {
+		for _, item := range store.All() {
+			if filter != nil && !filter(item) {
+				continue
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over store item keys
+func Keys(store Store) iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for item := range Items(store) {
+			if !yield(item.GetKey()) {
+				return
+			}
+		}
+	}
+}
+
+// KeyedItems returns an iterator over store key, item pairs
+func KeyedItems(store Store) iter.Seq2[interface{}, StoreItem] {
+	return KeyedFiltered(store, nil)
+}
+
+// KeyedFiltered returns an iterator over key, item pairs where filter returns true
+func KeyedFiltered(store Store, filter Filter) iter.Seq2[interface{}, StoreItem] {
+	return func(yield func(interface{}, StoreItem) bool) {
+		for item := range Filtered(store, filter) {
+			if !yield(item.GetKey(), item) {
+				return
+			}
+		}
+	}
+}
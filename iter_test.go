@@ -0,0 +1,79 @@
+//go:build go1.23
+
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Items
+func Test_Items(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 10)
+
+	count := 0
+	for item := range tinystore.Items(store) {
+		if count == 0 {
+			// not seen by the running iteration
+			store.Add(&DumyyItem{"new", "1234"})
+		}
+		if AsCredentialGetName(item) == "new" {
+			t.Error("Iteration saw a concurrent Add")
+		}
+		count++
+	}
+	if count != 10 {
+		t.Errorf("Bad count: %v", count)
+	}
+
+	count = 0
+	for range tinystore.Items(store) {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Error("Break failed")
+	}
+}
+
+// Test_Filtered_Keys
+func Test_Filtered_Keys(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 10)
+
+	for item := range tinystore.Filtered(store, NameFilter("3")) {
+		if AsCredentialGetName(item) != "3" {
+			t.Errorf("Bad item: %v", item)
+		}
+	}
+
+	keys := make([]interface{}, 0)
+	for key := range tinystore.Keys(store) {
+		keys = append(keys, key)
+	}
+	if len(keys) != 10 || keys[9] != "9" {
+		t.Errorf("Bad keys: %v", keys)
+	}
+
+	for key, item := range tinystore.KeyedFiltered(store, NameFilter("7")) {
+		if key != "7" || AsCredentialGetName(item) != "7" {
+			t.Errorf("Bad pair: %v, %v", key, item)
+		}
+	}
+	count := 0
+	for key, item := range tinystore.KeyedItems(store) {
+		if key != item.GetKey() {
+			t.Error("Bad pair")
+		}
+		count++
+		break
+	}
+	if count != 1 {
+		t.Error("Break failed")
+	}
+}
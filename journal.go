@@ -0,0 +1,366 @@
+package tinystore
+
+import (
+	"reflect"
+	"sync"
+)
+
+// journalChange an item as it was before and after a mutation, nil if absent
+type journalChange struct {
+	key    interface{}
+	before StoreItem
+	after  StoreItem
+}
+
+// journalStep one undoable unit
+type journalStep []journalChange
+
+// journalState an item copy and its document, to tell changes apart
+type journalState struct {
+	item StoreItem
+	doc  map[string]interface{}
+}
+
+// JournalStore wraps a Store recording every mutation as an undoable step,
+// multi item mutations like RemoveWhere and ForEach are single steps, see Group to merge calls.
+// Items should implement Cloner, otherwise mutators changing items in place rewrite the journal.
+// Changes made to the wrapped store directly are not recorded
+type JournalStore struct {
+	store Store
+	depth int
+
+	mutex sync.Mutex
+	undo  []journalStep
+	redo  []journalStep
+}
+
+// NewJournalStore wraps store keeping up to depth steps, depth <= 0 keeps everything
+func NewJournalStore(store Store, depth int) *JournalStore {
+	return &JournalStore{store: store, depth: depth}
+}
+
+// CanUndo returns true if there is a step to undo
+func (s *JournalStore) CanUndo() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.undo) > 0
+}
+
+// CanRedo returns true if there is a step to redo
+func (s *JournalStore) CanRedo() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.redo) > 0
+}
+
+// Undo reverts the last step, ErrNothingToUndo if none
+func (s *JournalStore) Undo() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.undo) == 0 {
+		return ErrNothingToUndo
+	}
+	step := s.undo[len(s.undo)-1]
+	if e := s.revert(step); e != nil {
+		return e
+	}
+	s.undo = s.undo[:len(s.undo)-1]
+	s.redo = append(s.redo, step)
+	return nil
+}
+
+// Redo applies again the last undone step, ErrNothingToRedo if none.
+// Any new mutation drops the steps to redo
+func (s *JournalStore) Redo() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.redo) == 0 {
+		return ErrNothingToRedo
+	}
+	step := s.redo[len(s.redo)-1]
+	for _, change := range step {
+		if e := s.set(change.key, change.after); e != nil {
+			return e
+		}
+	}
+	s.redo = s.redo[:len(s.redo)-1]
+	s.undo = append(s.undo, step)
+	return nil
+}
+
+// Group runs f holding the journal lock, the mutations f makes through store, the Store passed to it,
+// are recorded as a single step, if f fails they are reverted and its error returned.
+// Other callers wait until the group ends, f must not use s itself
+func (s *JournalStore) Group(f func(store Store) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	group := &journalGroup{journal: s}
+	e := f(group)
+	if e != nil {
+		s.revert(group.step)
+		return e
+	}
+	s.push(group.step)
+	return nil
+}
+
+// revert sets the items of step back as they were, caller holds the lock
+func (s *JournalStore) revert(step journalStep) error {
+	for i := len(step) - 1; i >= 0; i-- {
+		if e := s.set(step[i].key, step[i].before); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// set replaces the item matching key with a copy of item, removes it if item is nil
+func (s *JournalStore) set(key interface{}, item StoreItem) error {
+	if current, e := FindByKey(s.store, key); e == nil {
+		if e = s.store.Remove(current); e != nil {
+			return e
+		}
+	}
+	if item == nil {
+		return nil
+	}
+	return s.store.Add(cloneItem(item))
+}
+
+// cloneItem returns item.Clone() if item is a Cloner, item otherwise
+func cloneItem(item StoreItem) StoreItem {
+	if cloner, ok := item.(Cloner); ok {
+		return cloner.Clone()
+	}
+	return item
+}
+
+// push records step, caller holds the lock
+func (s *JournalStore) push(step journalStep) {
+	if len(step) == 0 {
+		return
+	}
+	s.redo = nil
+	s.undo = append(s.undo, step)
+	if s.depth > 0 && len(s.undo) > s.depth {
+		s.undo = append([]journalStep{}, s.undo[len(s.undo)-s.depth:]...)
+	}
+}
+
+// snapshot returns copies of the items matching keys, every item if keys is nil
+func (s *JournalStore) snapshot(keys []interface{}) (map[interface{}]journalState, error) {
+	items := make([]StoreItem, 0)
+	if keys == nil {
+		items = s.store.All()
+	} else {
+		for _, key := range keys {
+			if item, e := FindByKey(s.store, key); e == nil {
+				items = append(items, item)
+			}
+		}
+	}
+	states := make(map[interface{}]journalState, len(items))
+	for _, item := range items {
+		doc, e := document(item, rawSecrets, nil)
+		if e != nil {
+			return nil, e
+		}
+		states[item.GetKey()] = journalState{item: cloneItem(item), doc: doc}
+	}
+	return states, nil
+}
+
+// mutate runs f recording the changes to the items matching keys, every item if keys is nil, as a step
+func (s *JournalStore) mutate(keys []interface{}, f func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	step, e := s.changes(keys, f)
+	s.push(step)
+	return e
+}
+
+// changes runs f returning the items matching keys, every item if keys is nil, before and after,
+// caller holds the lock
+func (s *JournalStore) changes(keys []interface{}, f func() error) (journalStep, error) {
+	before, e := s.snapshot(keys)
+	if e != nil {
+		return nil, e
+	}
+	e = f()
+	after, ex := s.snapshot(keys)
+	if ex != nil {
+		return nil, ex
+	}
+
+	// recorded even if f failed, bulk mutations may have been partially applied
+	step := make(journalStep, 0)
+	for key, old := range before {
+		current, exists := after[key]
+		if !exists {
+			step = append(step, journalChange{key: key, before: old.item})
+		} else if !reflect.DeepEqual(old.doc, current.doc) {
+			step = append(step, journalChange{key: key, before: old.item, after: current.item})
+		}
+	}
+	for key, current := range after {
+		if _, exists := before[key]; !exists {
+			step = append(step, journalChange{key: key, after: current.item})
+		}
+	}
+	return step, e
+}
+
+// GetName implements Store.GetName
+func (s *JournalStore) GetName() string {
+	return s.store.GetName()
+}
+
+// All implements Store.All
+func (s *JournalStore) All() []StoreItem {
+	return s.store.All()
+}
+
+// Find implements Store.Find
+func (s *JournalStore) Find(filter Filter) (StoreItem, error) {
+	return s.store.Find(filter)
+}
+
+// Load implements Store.Load
+func (s *JournalStore) Load(items ...StoreItem) error {
+	return s.mutate(nil, func() error {
+		return s.store.Load(items...)
+	})
+}
+
+// Add implements Store.Add
+func (s *JournalStore) Add(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return s.mutate([]interface{}{item.GetKey()}, func() error {
+		return s.store.Add(item)
+	})
+}
+
+// Remove implements Store.Remove
+func (s *JournalStore) Remove(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return s.mutate([]interface{}{item.GetKey()}, func() error {
+		return s.store.Remove(item)
+	})
+}
+
+// Clear implements Store.Clear
+func (s *JournalStore) Clear() {
+	s.mutate(nil, func() error {
+		s.store.Clear()
+		return nil
+	})
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *JournalStore) RemoveWhere(filter Filter) error {
+	return s.mutate(nil, func() error {
+		return s.store.RemoveWhere(filter)
+	})
+}
+
+// ForEach implements Store.ForEach
+func (s *JournalStore) ForEach(f Mutator) error {
+	return s.mutate(nil, func() error {
+		return s.store.ForEach(f)
+	})
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (s *JournalStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return s.mutate(nil, func() error {
+		return s.store.ForEachWhere(filter, transform)
+	})
+}
+
+// journalGroup Store view passed to Group functions, records into one step, the journal lock is held
+type journalGroup struct {
+	journal *JournalStore
+	step    journalStep
+}
+
+// mutate runs f adding its changes to the group step
+func (g *journalGroup) mutate(keys []interface{}, f func() error) error {
+	step, e := g.journal.changes(keys, f)
+	g.step = append(g.step, step...)
+	return e
+}
+
+// GetName implements Store.GetName
+func (g *journalGroup) GetName() string {
+	return g.journal.store.GetName()
+}
+
+// All implements Store.All
+func (g *journalGroup) All() []StoreItem {
+	return g.journal.store.All()
+}
+
+// Find implements Store.Find
+func (g *journalGroup) Find(filter Filter) (StoreItem, error) {
+	return g.journal.store.Find(filter)
+}
+
+// Load implements Store.Load
+func (g *journalGroup) Load(items ...StoreItem) error {
+	return g.mutate(nil, func() error {
+		return g.journal.store.Load(items...)
+	})
+}
+
+// Add implements Store.Add
+func (g *journalGroup) Add(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return g.mutate([]interface{}{item.GetKey()}, func() error {
+		return g.journal.store.Add(item)
+	})
+}
+
+// Remove implements Store.Remove
+func (g *journalGroup) Remove(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return g.mutate([]interface{}{item.GetKey()}, func() error {
+		return g.journal.store.Remove(item)
+	})
+}
+
+// Clear implements Store.Clear
+func (g *journalGroup) Clear() {
+	g.mutate(nil, func() error {
+		g.journal.store.Clear()
+		return nil
+	})
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (g *journalGroup) RemoveWhere(filter Filter) error {
+	return g.mutate(nil, func() error {
+		return g.journal.store.RemoveWhere(filter)
+	})
+}
+
+// ForEach implements Store.ForEach
+func (g *journalGroup) ForEach(f Mutator) error {
+	return g.mutate(nil, func() error {
+		return g.journal.store.ForEach(f)
+	})
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (g *journalGroup) ForEachWhere(filter Filter, transform Mutator) error {
+	return g.mutate(nil, func() error {
+		return g.journal.store.ForEachWhere(filter, transform)
+	})
+}
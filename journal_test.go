@@ -0,0 +1,152 @@
+package tinystore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+func passwords(store tinystore.Store) string {
+	result := ""
+	for _, key := range []string{"a", "b", "c"} {
+		if item, e := tinystore.FindByKey(store, key); e == nil {
+			result += item.(*DumyyItem).Password
+		} else {
+			result += "-"
+		}
+	}
+	return result
+}
+
+// Test_JournalStore
+func Test_JournalStore(t *testing.T) {
+
+	store := tinystore.NewJournalStore(&tinystore.SimpleStore{}, 0)
+	store.Add(&DumyyItem{"a", "1"})
+	store.Add(&DumyyItem{"b", "2"})
+	store.Add(&DumyyItem{"c", "3"})
+	// in place
+	store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		item.(*DumyyItem).Password = "x"
+		return item, nil
+	})
+	store.RemoveWhere(NameFilter("b"))
+
+	if passwords(store) != "x-x" {
+		t.Errorf("Bad state %s", passwords(store))
+		return
+	}
+	for _, expected := range []string{"xxx", "123", "12-", "1--", "---"} {
+		if e := store.Undo(); e != nil {
+			t.Error(e)
+			return
+		}
+		if passwords(store) != expected {
+			t.Errorf("Expected %s, got %s", expected, passwords(store))
+			return
+		}
+	}
+	if e := store.Undo(); e != tinystore.ErrNothingToUndo {
+		t.Error("Nothing left")
+		return
+	}
+
+	store.Redo()
+	store.Redo()
+	if passwords(store) != "12-" || !store.CanRedo() {
+		t.Errorf("Should redo, got %s", passwords(store))
+		return
+	}
+	store.Remove(&DumyyItem{"a", "1"})
+	if store.CanRedo() {
+		t.Error("New mutations should drop redo")
+		return
+	}
+	if e := store.Redo(); e != tinystore.ErrNothingToRedo {
+		t.Error("Nothing to redo")
+		return
+	}
+	store.Undo()
+	if passwords(store) != "12-" {
+		t.Errorf("Should bring a back, got %s", passwords(store))
+		return
+	}
+}
+
+// Test_JournalStore_Group
+func Test_JournalStore_Group(t *testing.T) {
+
+	store := tinystore.NewJournalStore(&tinystore.SimpleStore{}, 2)
+	store.Add(&DumyyItem{"a", "1"})
+
+	e := store.Group(func(group tinystore.Store) error {
+		group.Add(&DumyyItem{"b", "2"})
+		group.Remove(&DumyyItem{"a", "1"})
+		return group.Add(&DumyyItem{"c", "3"})
+	})
+	if e != nil || passwords(store) != "-23" {
+		t.Errorf("Should apply the group: %v, %s", e, passwords(store))
+		return
+	}
+
+	failure := errors.New("failed")
+	e = store.Group(func(group tinystore.Store) error {
+		group.Clear()
+		return failure
+	})
+	if e != failure || passwords(store) != "-23" {
+		t.Errorf("Failed group should be reverted: %v, %s", e, passwords(store))
+		return
+	}
+
+	store.Undo()
+	if passwords(store) != "1--" {
+		t.Errorf("Should undo the group at once, got %s", passwords(store))
+		return
+	}
+	store.Undo()
+	if store.CanUndo() || passwords(store) != "---" {
+		t.Errorf("Depth should be 2, got %s", passwords(store))
+		return
+	}
+
+	store.Add(&DumyyItem{"a", "1"})
+	store.Add(&DumyyItem{"b", "2"})
+	store.Add(&DumyyItem{"c", "3"})
+	store.Undo()
+	store.Undo()
+	if store.CanUndo() || passwords(store) != "1--" {
+		t.Errorf("Should keep 2 steps, got %s", passwords(store))
+		return
+	}
+}
+
+// Test_JournalStore_GroupConcurrent
+func Test_JournalStore_GroupConcurrent(t *testing.T) {
+
+	store := tinystore.NewJournalStore(&tinystore.SimpleStore{}, 10)
+	written := make(chan error)
+	e := store.Group(func(group tinystore.Store) error {
+		go func() {
+			written <- store.Add(&DumyyItem{"c", "3"})
+		}()
+		time.Sleep(10 * time.Millisecond)
+		group.Add(&DumyyItem{"a", "1"})
+		return group.Add(&DumyyItem{"b", "2"})
+	})
+	if e != nil || <-written != nil {
+		t.Error("Should apply both")
+		return
+	}
+	store.Undo()
+	if passwords(store) != "12-" {
+		t.Errorf("Other writes should be their own step, got %s", passwords(store))
+		return
+	}
+	store.Undo()
+	if passwords(store) != "---" {
+		t.Errorf("Should undo the group at once, got %s", passwords(store))
+		return
+	}
+}
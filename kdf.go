@@ -0,0 +1,162 @@
+package tinystore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// kdfPBKDF2 header name of PBKDF2 with HMAC-SHA256
+	kdfPBKDF2 = "PBKDF2-SHA256"
+	// DefaultIterations PBKDF2 iterations used when none are given
+	DefaultIterations = 600000
+	// maxIterations bounds the work an unauthenticated header can ask for
+	maxIterations = 10000000
+)
+
+// pbkdf2Key derives keyLength bytes from password with PBKDF2-HMAC-SHA256 (RFC 8018)
+func pbkdf2Key(password string, salt []byte, iterations int, keyLength int) ([]byte, error) {
+	if iterations <= 0 || keyLength <= 0 {
+		return nil, fmt.Errorf("tinystore: invalid pbkdf2 parameters, %d iterations, %d bytes", iterations, keyLength)
+	}
+	prf := hmac.New(sha256.New, []byte(password))
+	key := make([]byte, 0, keyLength+prf.Size())
+	u := make([]byte, prf.Size())
+	t := make([]byte, prf.Size())
+	for block := uint32(1); len(key) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength], nil
+}
+
+// Passphrase a KeyProvider deriving a 32 byte key from a passphrase with PBKDF2-SHA256,
+// every encryption uses a new random salt
+type Passphrase struct {
+	Passphrase string
+	// Iterations zero means DefaultIterations
+	Iterations int
+}
+
+func (p Passphrase) NewKey() ([]byte, *KDFParams, error) {
+	kdf := &KDFParams{Name: kdfPBKDF2, Salt: make([]byte, 16), Iterations: p.Iterations}
+	if kdf.Iterations <= 0 {
+		kdf.Iterations = DefaultIterations
+	}
+	if _, e := rand.Read(kdf.Salt); e != nil {
+		return nil, nil, e
+	}
+	key, e := p.Key(kdf)
+	return key, kdf, e
+}
+
+func (p Passphrase) Key(kdf *KDFParams) ([]byte, error) {
+	if kdf == nil {
+		return nil, ErrDecryptionFailed.Wrap(fmt.Errorf("file key is not derived from a passphrase"))
+	}
+	if kdf.Name != kdfPBKDF2 || kdf.Iterations <= 0 || kdf.Iterations > maxIterations || len(kdf.Salt) == 0 {
+		return nil, ErrInvalidEncryptedData.Wrap(fmt.Errorf("unsupported kdf %s, %d iterations", kdf.Name, kdf.Iterations))
+	}
+	return pbkdf2Key(p.Passphrase, kdf.Salt, kdf.Iterations, 32)
+}
+
+// PBKDF2Hasher a Hasher using PBKDF2-SHA256, zero fields mean their defaults:
+// DefaultIterations, 16 bytes of salt and 32 bytes of hash
+type PBKDF2Hasher struct {
+	Iterations int
+	SaltLength int
+	KeyLength  int
+}
+
+// pbkdf2Name hasher name in encoded hashes
+const pbkdf2Name = "pbkdf2-sha256"
+
+func (h PBKDF2Hasher) params() (iterations int, saltLength int, keyLength int) {
+	iterations, saltLength, keyLength = h.Iterations, h.SaltLength, h.KeyLength
+	if iterations <= 0 {
+		iterations = DefaultIterations
+	}
+	if saltLength <= 0 {
+		saltLength = 16
+	}
+	if keyLength <= 0 {
+		keyLength = 32
+	}
+	return iterations, saltLength, keyLength
+}
+
+func (h PBKDF2Hasher) Name() string {
+	return pbkdf2Name
+}
+
+// Hash returns "$pbkdf2-sha256$i=<iterations>$<salt>$<hash>", salt and hash in unpadded base64
+func (h PBKDF2Hasher) Hash(password string) (string, error) {
+	iterations, saltLength, keyLength := h.params()
+	salt := make([]byte, saltLength)
+	if _, e := rand.Read(salt); e != nil {
+		return "", e
+	}
+	key, e := pbkdf2Key(password, salt, iterations, keyLength)
+	if e != nil {
+		return "", e
+	}
+	return fmt.Sprintf("$%s$i=%d$%s$%s", pbkdf2Name, iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// parse returns the parameters of an encoded hash
+func (h PBKDF2Hasher) parse(encoded string) (iterations int, salt []byte, key []byte, e error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != pbkdf2Name {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if _, e = fmt.Sscanf(parts[2], "i=%d", &iterations); e != nil || iterations <= 0 || iterations > maxIterations {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if salt, e = base64.RawStdEncoding.DecodeString(parts[3]); e != nil || len(salt) == 0 {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	if key, e = base64.RawStdEncoding.DecodeString(parts[4]); e != nil || len(key) == 0 {
+		return 0, nil, nil, ErrInvalidHash
+	}
+	return iterations, salt, key, nil
+}
+
+func (h PBKDF2Hasher) Verify(encoded string, password string) (bool, error) {
+	iterations, salt, key, e := h.parse(encoded)
+	if e != nil {
+		return false, e
+	}
+	derived, e := pbkdf2Key(password, salt, iterations, len(key))
+	if e != nil {
+		return false, e
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+func (h PBKDF2Hasher) NeedsRehash(encoded string) bool {
+	iterations, salt, key, e := h.parse(encoded)
+	if e != nil {
+		return true
+	}
+	want, saltLength, keyLength := h.params()
+	return iterations != want || len(salt) != saltLength || len(key) != keyLength
+}
@@ -0,0 +1,73 @@
+package tinystore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Passphrase
+func Test_Passphrase(t *testing.T) {
+
+	provider := tinystore.Passphrase{Passphrase: "correct horse", Iterations: 1000}
+	data, e := tinystore.Encrypt([]byte(`[]`), provider)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	header, _ := tinystore.ReadHeader(data)
+	if header.KDF == nil || header.KDF.Iterations != 1000 || len(header.KDF.Salt) == 0 {
+		t.Errorf("Bad header: %+v", header)
+		return
+	}
+
+	if plaintext, e := tinystore.Decrypt(data, tinystore.Passphrase{Passphrase: "correct horse"}); e != nil || string(plaintext) != `[]` {
+		t.Errorf("Should use the header iterations: %v", e)
+		return
+	}
+	if _, e := tinystore.Decrypt(data, tinystore.Passphrase{Passphrase: "battery staple"}); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Wrong passphrase should fail: %v", e)
+		return
+	}
+
+	again, _ := tinystore.Encrypt([]byte(`[]`), provider)
+	if other, _ := tinystore.ReadHeader(again); bytes.Equal(other.KDF.Salt, header.KDF.Salt) {
+		t.Error("Salt should be random")
+		return
+	}
+
+	keyed, _ := tinystore.Encrypt([]byte(`[]`), testKey(1))
+	if _, e := tinystore.Decrypt(keyed, provider); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Should not decrypt a file without kdf: %v", e)
+		return
+	}
+
+	greedy := bytes.Replace(data, []byte(`"iterations":1000`), []byte(`"iterations":1000000000`), 1)
+	if _, e := tinystore.Decrypt(greedy, provider); !errors.Is(e, tinystore.ErrInvalidEncryptedData) {
+		t.Errorf("Should refuse unbounded work: %v", e)
+		return
+	}
+}
+
+// Test_Passphrase_PBKDF2 RFC 7914 PBKDF2-HMAC-SHA256 test vectors, first 32 bytes
+func Test_Passphrase_PBKDF2(t *testing.T) {
+
+	vectors := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		expected   string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, vector := range vectors {
+		key, e := tinystore.Passphrase{Passphrase: vector.passphrase}.Key(&tinystore.KDFParams{Name: "PBKDF2-SHA256", Salt: []byte(vector.salt), Iterations: vector.iterations})
+		if e != nil || hex.EncodeToString(key) != vector.expected {
+			t.Errorf("Bad key for %s: %x, %v", vector.passphrase, key, e)
+			return
+		}
+	}
+}
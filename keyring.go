@@ -0,0 +1,228 @@
+package tinystore
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// maxWrappedKeys keys a Keyring can hold and a file header can carry
+const maxWrappedKeys = 16
+
+// WrappedKey the data key of a file sealed with AES-GCM by the key KeyID, the id is the additional data
+type WrappedKey struct {
+	KeyID  string     `json:"key_id"`
+	Cipher string     `json:"cipher"`
+	Nonce  []byte     `json:"nonce"`
+	Key    []byte     `json:"key"`
+	KDF    *KDFParams `json:"kdf,omitempty"`
+}
+
+// Keyring a KeyProvider holding identified keys. Files are encrypted with a random data key wrapped
+// by every key in the ring, so readers knowing any of them can decrypt, Remove retires a key from
+// the next save on. Rotate changes the current key, files encrypted directly with a single key
+// are decrypted by trying every key
+type Keyring struct {
+	mutex   sync.RWMutex
+	current string
+	keys    map[string]KeyProvider
+}
+
+// NewKeyring returns a Keyring whose current key is id
+func NewKeyring(id string, provider KeyProvider) *Keyring {
+	return &Keyring{current: id, keys: map[string]KeyProvider{id: provider}}
+}
+
+// Add adds or replaces key id, the current key doesn't change.
+// Encrypt fails if the ring holds more than 16 keys
+func (r *Keyring) Add(id string, provider KeyProvider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keys[id] = provider
+}
+
+// Rotate adds key id and makes it current
+func (r *Keyring) Rotate(id string, provider KeyProvider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keys[id] = provider
+	r.current = id
+}
+
+// Remove retires key id, the current key can't be removed
+func (r *Keyring) Remove(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if id == r.current {
+		return fmt.Errorf("tinystore: can't remove current key %s", id)
+	}
+	if _, exists := r.keys[id]; !exists {
+		return ErrNotFound
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+// Current id of the current key
+func (r *Keyring) Current() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.current
+}
+
+// IDs of the keys, current first then sorted
+func (r *Keyring) IDs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.ids()
+}
+
+// ids caller holds the lock
+func (r *Keyring) ids() []string {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		if id != r.current {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return append([]string{r.current}, ids...)
+}
+
+// lookup returns key id, nil if unknown
+func (r *Keyring) lookup(id string) KeyProvider {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.keys[id]
+}
+
+// NewKey implements KeyProvider.NewKey with the current key
+func (r *Keyring) NewKey() ([]byte, *KDFParams, error) {
+	return r.lookup(r.Current()).NewKey()
+}
+
+// Key implements KeyProvider.Key with the current key
+func (r *Keyring) Key(kdf *KDFParams) ([]byte, error) {
+	return r.lookup(r.Current()).Key(kdf)
+}
+
+// wrap returns a new data key wrapped by every key
+func (r *Keyring) wrap() ([]byte, []WrappedKey, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(r.keys) > maxWrappedKeys {
+		return nil, nil, fmt.Errorf("tinystore: %d keys, at most %d can wrap a file", len(r.keys), maxWrappedKeys)
+	}
+	dek := make([]byte, 32)
+	if _, e := rand.Read(dek); e != nil {
+		return nil, nil, e
+	}
+	wrapped := make([]WrappedKey, 0, len(r.keys))
+	for _, id := range r.ids() {
+		key, kdf, e := r.keys[id].NewKey()
+		if e != nil {
+			return nil, nil, fmt.Errorf("tinystore: key %s: %w", id, e)
+		}
+		nonce, e := randomNonce(key)
+		if e != nil {
+			return nil, nil, e
+		}
+		gcm, e := newGCM(key)
+		if e != nil {
+			return nil, nil, e
+		}
+		wrapped = append(wrapped, WrappedKey{
+			KeyID:  id,
+			Cipher: cipherName(key),
+			Nonce:  nonce,
+			Key:    gcm.Seal(nil, nonce, dek, []byte(id)),
+			KDF:    kdf,
+		})
+	}
+	return dek, wrapped, nil
+}
+
+// unwrap returns the data key and the id of the key that unwrapped it, a Keyring only tries
+// the ids it knows, other providers try every wrapped key. The header isn't authenticated yet,
+// so the key derivations it asks for must not add up to more than maxIterations
+func unwrap(keys []WrappedKey, provider KeyProvider) ([]byte, string, error) {
+	ring, isRing := provider.(*Keyring)
+	candidates := make([]KeyProvider, len(keys))
+	iterations := 0
+	for i, wrapped := range keys {
+		candidates[i] = provider
+		if isRing {
+			candidates[i] = ring.lookup(wrapped.KeyID)
+		}
+		if candidates[i] != nil && wrapped.KDF != nil && wrapped.KDF.Iterations > 0 {
+			iterations += wrapped.KDF.Iterations
+		}
+		if iterations > maxIterations {
+			return nil, "", ErrInvalidEncryptedData.Wrap(fmt.Errorf("key derivations need more than %d iterations", maxIterations))
+		}
+	}
+	var err error = ErrDecryptionFailed
+	for i, wrapped := range keys {
+		candidate := candidates[i]
+		if candidate == nil {
+			continue
+		}
+		key, e := candidate.Key(wrapped.KDF)
+		if e != nil {
+			err = e
+			continue
+		}
+		dek, e := open(key, wrapped.Cipher, wrapped.Nonce, wrapped.Key, []byte(wrapped.KeyID))
+		if e != nil {
+			continue
+		}
+		return dek, wrapped.KeyID, nil
+	}
+	if isRing && err == ErrDecryptionFailed {
+		return nil, "", ErrDecryptionFailed.Wrap(fmt.Errorf("no known key among %v", EncryptedHeader{Keys: keys}.KeyIDs()))
+	}
+	return nil, "", err
+}
+
+// openDirect decrypts a file encrypted directly with a single key trying every key of ring
+func (r *Keyring) openDirect(header EncryptedHeader, file encryptedFile) ([]byte, string, error) {
+	var err error = ErrDecryptionFailed
+	for _, id := range r.IDs() {
+		key, e := r.lookup(id).Key(header.KDF)
+		if e != nil {
+			err = e
+			continue
+		}
+		plaintext, e := open(key, header.Cipher, header.Nonce, file.Data, file.Header)
+		if e == nil {
+			return plaintext, id, nil
+		}
+		if e != ErrDecryptionFailed {
+			err = e
+		}
+	}
+	return nil, "", err
+}
+
+// Rekey decrypts data with from and encrypts it again with to, with a new data key
+func Rekey(data []byte, from KeyProvider, to KeyProvider) ([]byte, error) {
+	plaintext, e := Decrypt(data, from)
+	if e != nil {
+		return nil, e
+	}
+	return Encrypt(plaintext, to)
+}
+
+// RekeyFile rekeys the file at path, replacing it atomically
+func RekeyFile(path string, from KeyProvider, to KeyProvider) error {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return e
+	}
+	if data, e = Rekey(data, from, to); e != nil {
+		return e
+	}
+	return writeFile(path, data)
+}
@@ -0,0 +1,174 @@
+package tinystore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Keyring
+func Test_Keyring(t *testing.T) {
+
+	ring := tinystore.NewKeyring("v1", testKey(1))
+	data, e := tinystore.Encrypt([]byte(`[]`), ring)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if header, _ := tinystore.ReadHeader(data); header.Version != 2 || len(header.KeyIDs()) != 1 || header.KeyIDs()[0] != "v1" {
+		t.Errorf("Bad header: %+v", header)
+		return
+	}
+
+	ring.Rotate("v2", testKey(2))
+	if id, e := tinystore.VerifyKey(data, ring); e != nil || id != "v1" {
+		t.Errorf("Should decrypt with the old key: %v %v", id, e)
+		return
+	}
+
+	data, _ = tinystore.Encrypt([]byte(`[]`), ring)
+	header, _ := tinystore.ReadHeader(data)
+	if ids := header.KeyIDs(); len(ids) != 2 || ids[0] != "v2" || ids[1] != "v1" {
+		t.Errorf("Should wrap for every key, current first: %v", ids)
+		return
+	}
+	if id, e := tinystore.VerifyKey(data, ring); e != nil || id != "v2" {
+		t.Errorf("Should decrypt with the current key: %v %v", id, e)
+		return
+	}
+	if id, e := tinystore.VerifyKey(data, testKey(1)); e != nil || id != "v1" {
+		t.Errorf("Old readers should keep working: %v %v", id, e)
+		return
+	}
+
+	if e := ring.Remove("v2"); e == nil {
+		t.Error("Should not remove the current key")
+		return
+	}
+	if e := ring.Remove("v1"); e != nil {
+		t.Error(e)
+		return
+	}
+	data, _ = tinystore.Encrypt([]byte(`[]`), ring)
+	if _, e := tinystore.Decrypt(data, testKey(1)); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Retired key should fail: %v", e)
+		return
+	}
+
+	other := tinystore.NewKeyring("x", testKey(3))
+	if _, e := tinystore.Decrypt(data, other); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Unknown ids should fail: %v", e)
+		return
+	}
+}
+
+// Test_Keyring_Direct files encrypted with a single key are opened by any key of the ring
+func Test_Keyring_Direct(t *testing.T) {
+
+	data, _ := tinystore.Encrypt([]byte(`[]`), testKey(1))
+
+	ring := tinystore.NewKeyring("v2", testKey(2))
+	ring.Add("v1", testKey(1))
+	if id, e := tinystore.VerifyKey(data, ring); e != nil || id != "v1" {
+		t.Errorf("Should open with v1: %v %v", id, e)
+		return
+	}
+	if ring.Current() != "v2" {
+		t.Error("Add should not change the current key")
+		return
+	}
+}
+
+// Test_RekeyFile
+func Test_RekeyFile(t *testing.T) {
+
+	store := credentialStore(t)
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	tinystore.SaveEncryptedFile(store, path, testKey(1))
+
+	ring := tinystore.NewKeyring("v1", testKey(1))
+	ring.Rotate("v2", testKey(2))
+	ring.Remove("v1")
+	if e := tinystore.RekeyFile(path, testKey(1), ring); e != nil {
+		t.Error(e)
+		return
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if id, e := tinystore.VerifyKey(data, ring); e != nil || id != "v2" {
+		t.Errorf("Should use the new key: %v %v", id, e)
+		return
+	}
+	store.Clear()
+	if e := tinystore.LoadEncryptedFile(store, path, testKey(2)); e != nil || tinystore.Length(store) != 2 {
+		t.Errorf("Should load the rekeyed file: %v", e)
+		return
+	}
+	if e := tinystore.RekeyFile(path, testKey(1), ring); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Old key should fail: %v", e)
+		return
+	}
+}
+
+// craftHeader returns data with its header keys replaced by change, test only
+func craftHeader(data []byte, change func(keys []tinystore.WrappedKey) []tinystore.WrappedKey) []byte {
+	file := struct {
+		Header json.RawMessage `json:"header"`
+		Data   []byte          `json:"data"`
+	}{}
+	json.Unmarshal(data, &file)
+	header, _ := tinystore.ReadHeader(data)
+	header.Keys = change(header.Keys)
+	file.Header, _ = json.Marshal(header)
+	crafted, _ := json.Marshal(file)
+	return crafted
+}
+
+// Test_Keyring_Header crafted headers can't ask for unbounded work
+func Test_Keyring_Header(t *testing.T) {
+
+	ring := tinystore.NewKeyring("v1", tinystore.Passphrase{Passphrase: "correct horse", Iterations: 1000})
+	data, e := tinystore.Encrypt([]byte(`[]`), ring)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+
+	many := craftHeader(data, func(keys []tinystore.WrappedKey) []tinystore.WrappedKey {
+		for len(keys) <= 16 {
+			keys = append(keys, keys[0])
+		}
+		return keys
+	})
+	if _, e := tinystore.Decrypt(many, ring); !errors.Is(e, tinystore.ErrInvalidEncryptedData) {
+		t.Errorf("Should reject too many keys: %v", e)
+		return
+	}
+
+	costly := craftHeader(data, func(keys []tinystore.WrappedKey) []tinystore.WrappedKey {
+		for i := 0; i < 4; i++ {
+			wrapped := keys[0]
+			kdf := *wrapped.KDF
+			kdf.Iterations = 3000000
+			wrapped.KDF = &kdf
+			keys = append(keys, wrapped)
+		}
+		return keys
+	})
+	if _, e := tinystore.Decrypt(costly, tinystore.Passphrase{Passphrase: "wrong"}); !errors.Is(e, tinystore.ErrInvalidEncryptedData) {
+		t.Errorf("Should reject costly headers: %v", e)
+		return
+	}
+
+	for i := 2; i <= 17; i++ {
+		ring.Add(fmt.Sprint("v", i), testKey(byte(i)))
+	}
+	if _, e := tinystore.Encrypt([]byte(`[]`), ring); e == nil {
+		t.Error("Should not wrap for more than 16 keys")
+		return
+	}
+}
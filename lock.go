@@ -0,0 +1,49 @@
+package tinystore
+
+import (
+	"context"
+	"sync"
+)
+
+// contextMutex a mutex whose waiters can give up when their context is done,
+// the zero value is unlocked
+type contextMutex struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (m *contextMutex) init() {
+	m.once.Do(func() {
+		m.ch = make(chan struct{}, 1)
+	})
+}
+
+// Lock waits for the lock
+func (m *contextMutex) Lock() {
+	m.init()
+	m.ch <- struct{}{}
+}
+
+// LockContext waits for the lock or ctx, returns ErrCanceled wrapping ctx.Err()
+func (m *contextMutex) LockContext(ctx context.Context) error {
+	m.init()
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	select {
+	case m.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// Unlock releases the lock, panics if it isn't locked, like sync.Mutex
+func (m *contextMutex) Unlock() {
+	m.init()
+	select {
+	case <-m.ch:
+	default:
+		panic("tinystore: unlock of unlocked mutex")
+	}
+}
@@ -0,0 +1,380 @@
+package tinystore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TenantFunc extracts the tenant id of an item, "" if it has none
+type TenantFunc func(item StoreItem) string
+
+// NamespacedStore partitions items by tenant id, each tenant is an isolated SimpleStore.
+// Tenant(id) returns a Store view of one tenant named "<name>/<id>", LoadJson uses the adapter
+// registered for it or else the one registered for the NamespacedStore. Views refuse items
+// the TenantFunc assigns to another tenant. The NamespacedStore itself is a Store over every tenant,
+// Add routes items by its TenantFunc and fails with ErrNoTenant without one
+type NamespacedStore struct {
+	mutex    sync.Mutex
+	tenants  map[string]*SimpleStore
+	quotas   map[string]int
+	tenantOf TenantFunc
+
+	// Name instance name , nick name , identifier , etc...
+	Name string
+}
+
+// NewNamespacedStore returns an empty NamespacedStore, tenantOf may be nil
+func NewNamespacedStore(name string, tenantOf TenantFunc) *NamespacedStore {
+	return &NamespacedStore{
+		tenants:  make(map[string]*SimpleStore),
+		quotas:   make(map[string]int),
+		tenantOf: tenantOf,
+		Name:     name,
+	}
+}
+
+// tenant returns the tenant store, creates it if create, nil otherwise, caller holds the lock
+func (s *NamespacedStore) tenant(id string, create bool) *SimpleStore {
+	store, exists := s.tenants[id]
+	if !exists && create {
+		store = &SimpleStore{Name: s.Name + "/" + id}
+		s.tenants[id] = store
+	}
+	return store
+}
+
+// sorted tenant stores, caller holds the lock
+func (s *NamespacedStore) sorted() []*SimpleStore {
+	ids := s.namespaces()
+	stores := make([]*SimpleStore, len(ids))
+	for i, id := range ids {
+		stores[i] = s.tenants[id]
+	}
+	return stores
+}
+
+// namespaces caller holds the lock
+func (s *NamespacedStore) namespaces() []string {
+	ids := make([]string, 0, len(s.tenants))
+	for id := range s.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// allowed returns ErrQuotaExceeded if id can't hold count items, caller holds the lock
+func (s *NamespacedStore) allowed(id string, count int) error {
+	if quota, ok := s.quotas[id]; ok && count > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Tenant returns a Store view of tenant id, the namespace is created by its first write
+func (s *NamespacedStore) Tenant(id string) Store {
+	return &tenantStore{parent: s, id: id}
+}
+
+// SetQuota limits tenant id to max items, max < 0 removes the limit
+func (s *NamespacedStore) SetQuota(id string, max int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if max < 0 {
+		delete(s.quotas, id)
+		return
+	}
+	s.quotas[id] = max
+}
+
+// Namespaces returns the tenant ids, sorted
+func (s *NamespacedStore) Namespaces() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.namespaces()
+}
+
+// Copy replaces the items of tenant to with the items of tenant from,
+// items implementing Cloner are cloned
+func (s *NamespacedStore) Copy(from string, to string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	source := s.tenant(from, false)
+	if source == nil {
+		return ErrNotFound
+	}
+	items := make([]StoreItem, 0)
+	for _, item := range source.All() {
+		if cloner, ok := item.(Cloner); ok {
+			item = cloner.Clone()
+		}
+		items = append(items, item)
+	}
+	if e := s.allowed(to, len(items)); e != nil {
+		return e
+	}
+	return s.tenant(to, true).Load(items...)
+}
+
+// Drop removes tenant id and its items, quotas are kept
+func (s *NamespacedStore) Drop(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.tenants[id]; !exists {
+		return ErrNotFound
+	}
+	delete(s.tenants, id)
+	return nil
+}
+
+// GetName implements Store.GetName
+func (s *NamespacedStore) GetName() string {
+	return s.Name
+}
+
+// All implements Store.All, every tenant's items by tenant id
+func (s *NamespacedStore) All() []StoreItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	items := make([]StoreItem, 0)
+	for _, store := range s.sorted() {
+		items = append(items, store.All()...)
+	}
+	return items
+}
+
+// Find implements Store.Find
+func (s *NamespacedStore) Find(filter Filter) (StoreItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, store := range s.sorted() {
+		if item, e := store.Find(filter); e == nil {
+			return item, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Add implements Store.Add, into the item tenant
+func (s *NamespacedStore) Add(item StoreItem) error {
+	if s.tenantOf == nil {
+		return ErrNoTenant
+	}
+	id := s.tenantOf(item)
+	if id == "" {
+		return ErrNoTenant
+	}
+	return s.Tenant(id).Add(item)
+}
+
+// Remove implements Store.Remove, from the item tenant or from every tenant without a TenantFunc
+func (s *NamespacedStore) Remove(item StoreItem) error {
+	if s.tenantOf != nil {
+		if id := s.tenantOf(item); id != "" {
+			return s.Tenant(id).Remove(item)
+		}
+	}
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	return s.RemoveWhere(KeyEqualsFilter(item.GetKey()))
+}
+
+// Clear implements Store.Clear, drops every tenant
+func (s *NamespacedStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tenants = make(map[string]*SimpleStore)
+}
+
+// Load implements Store.Load, items are routed by the TenantFunc, nothing is loaded if any has no tenant
+// or a quota is exceeded
+func (s *NamespacedStore) Load(items ...StoreItem) error {
+	partitions := make(map[string][]StoreItem)
+	for _, item := range items {
+		id := ""
+		if s.tenantOf != nil {
+			id = s.tenantOf(item)
+		}
+		if id == "" {
+			return ErrNoTenant
+		}
+		partitions[id] = append(partitions[id], item)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, partition := range partitions {
+		if e := s.allowed(id, len(partition)); e != nil {
+			return e
+		}
+	}
+	s.tenants = make(map[string]*SimpleStore)
+	for id, partition := range partitions {
+		s.tenant(id, true).Load(partition...)
+	}
+	return nil
+}
+
+// RemoveWhere implements Store.RemoveWhere, across tenants
+func (s *NamespacedStore) RemoveWhere(filter Filter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var e error = ErrNotFound
+	for _, store := range s.sorted() {
+		if store.RemoveWhere(filter) == nil {
+			e = nil
+		}
+	}
+	return e
+}
+
+// ForEach implements Store.ForEach, across tenants
+func (s *NamespacedStore) ForEach(f Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, store := range s.sorted() {
+		if e := store.ForEach(f); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// ForEachWhere implements Store.ForEachWhere, across tenants
+func (s *NamespacedStore) ForEachWhere(filter Filter, transform Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var err error = ErrNotFound
+	for _, store := range s.sorted() {
+		e := store.ForEachWhere(filter, transform)
+		if e == ErrNotFound {
+			continue
+		}
+		if e != nil {
+			return e
+		}
+		err = nil
+	}
+	return err
+}
+
+// tenantStore Store view of one NamespacedStore tenant
+type tenantStore struct {
+	parent *NamespacedStore
+	id     string
+}
+
+// with runs f on the tenant store under the parent lock, creating the tenant if create,
+// a tenant created for a failing f is dropped again. A missing tenant behaves as an empty store
+func (t *tenantStore) with(create bool, f func(store *SimpleStore) error) error {
+	t.parent.mutex.Lock()
+	defer t.parent.mutex.Unlock()
+	_, existed := t.parent.tenants[t.id]
+	store := t.parent.tenant(t.id, create)
+	if store == nil {
+		store = &SimpleStore{}
+	}
+	e := f(store)
+	if e != nil && !existed && Length(store) == 0 {
+		delete(t.parent.tenants, t.id)
+	}
+	return e
+}
+
+func (t *tenantStore) GetName() string {
+	return t.parent.Name + "/" + t.id
+}
+
+// adapterName implements adapterNamer, the tenant adapter if registered, the parent one if not
+func (t *tenantStore) adapterName() string {
+	if _, exists := LookupAdapter(t.GetName()); exists {
+		return t.GetName()
+	}
+	return t.parent.Name
+}
+
+// owns returns an error if the TenantFunc assigns item to another tenant
+func (t *tenantStore) owns(item StoreItem) error {
+	if t.parent.tenantOf == nil {
+		return nil
+	}
+	if id := t.parent.tenantOf(item); id != "" && id != t.id {
+		return ErrInvalidStoreItem.Wrap(fmt.Errorf("%v belongs to tenant %q", item.GetKey(), id))
+	}
+	return nil
+}
+
+func (t *tenantStore) All() (items []StoreItem) {
+	t.with(false, func(store *SimpleStore) error {
+		items = store.All()
+		return nil
+	})
+	return items
+}
+
+func (t *tenantStore) Find(filter Filter) (item StoreItem, e error) {
+	t.with(false, func(store *SimpleStore) error {
+		item, e = store.Find(filter)
+		return nil
+	})
+	return item, e
+}
+
+func (t *tenantStore) Add(item StoreItem) error {
+	if e := t.owns(item); e != nil {
+		return e
+	}
+	return t.with(true, func(store *SimpleStore) error {
+		if e := t.parent.allowed(t.id, Length(store)+1); e != nil {
+			return e
+		}
+		return store.Add(item)
+	})
+}
+
+func (t *tenantStore) Remove(item StoreItem) error {
+	return t.with(false, func(store *SimpleStore) error {
+		return store.Remove(item)
+	})
+}
+
+func (t *tenantStore) Clear() {
+	t.with(false, func(store *SimpleStore) error {
+		store.Clear()
+		return nil
+	})
+}
+
+func (t *tenantStore) Load(items ...StoreItem) error {
+	for _, item := range items {
+		if e := t.owns(item); e != nil {
+			return e
+		}
+	}
+	return t.with(true, func(store *SimpleStore) error {
+		if e := t.parent.allowed(t.id, len(items)); e != nil {
+			return e
+		}
+		return store.Load(items...)
+	})
+}
+
+func (t *tenantStore) RemoveWhere(filter Filter) error {
+	return t.with(false, func(store *SimpleStore) error {
+		return store.RemoveWhere(filter)
+	})
+}
+
+func (t *tenantStore) ForEach(f Mutator) error {
+	return t.with(false, func(store *SimpleStore) error {
+		return store.ForEach(f)
+	})
+}
+
+func (t *tenantStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return t.with(false, func(store *SimpleStore) error {
+		return store.ForEachWhere(filter, transform)
+	})
+}
@@ -0,0 +1,219 @@
+package tinystore_test
+
+import (
+	"errors"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// tenantByPassword routes DumyyItems by password, test only
+func tenantByPassword(item tinystore.StoreItem) string {
+	return AsCredential(item).Password
+}
+
+// Test_NamespacedStore
+func Test_NamespacedStore(t *testing.T) {
+
+	store := tinystore.NewNamespacedStore("tenants", nil)
+	acme := store.Tenant("acme")
+	globex := store.Tenant("globex")
+
+	if acme.GetName() != "tenants/acme" {
+		t.Errorf("Bad name: %v", acme.GetName())
+		return
+	}
+
+	if e := acme.Add(&DumyyItem{"admin", "acme"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := globex.Add(&DumyyItem{"admin", "globex"}); e != nil {
+		t.Error("Same key should be allowed in another tenant")
+		return
+	}
+	if x, _ := tinystore.FindByKey(acme, "admin"); AsCredential(x).Password != "acme" {
+		t.Error("Tenants should be isolated")
+		return
+	}
+	if tinystore.Length(store) != 2 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+
+	if e := store.Add(&DumyyItem{"me", "1234"}); e != tinystore.ErrNoTenant {
+		t.Error("Should fail without a TenantFunc")
+		return
+	}
+
+	if _, e := tinystore.FindByKey(store.Tenant("initech"), "admin"); e != tinystore.ErrNotFound {
+		t.Error("Should be empty")
+		return
+	}
+	if e := store.Tenant("initech").Remove(&DumyyItem{"admin", "x"}); e != tinystore.ErrNotFound {
+		t.Error("Should not be found")
+		return
+	}
+	if len(store.Namespaces()) != 2 {
+		t.Errorf("Reads should not create tenants: %v", store.Namespaces())
+		return
+	}
+}
+
+// Test_NamespacedStore_Routing
+func Test_NamespacedStore_Routing(t *testing.T) {
+
+	store := tinystore.NewNamespacedStore("tenants", tenantByPassword)
+
+	store.Add(&DumyyItem{"admin", "acme"})
+	store.Add(&DumyyItem{"admin", "globex"})
+	if e := store.Add(&DumyyItem{"admin", "acme"}); e != tinystore.ErrAlreadyExists {
+		t.Error("Should exist in its tenant")
+		return
+	}
+	if e := store.Add(&DumyyItem{"nobody", ""}); e != tinystore.ErrNoTenant {
+		t.Error("Should fail without a tenant")
+		return
+	}
+
+	if ns := store.Namespaces(); len(ns) != 2 || ns[0] != "acme" || ns[1] != "globex" {
+		t.Errorf("Bad namespaces: %v", ns)
+		return
+	}
+
+	if e := store.Remove(&DumyyItem{"admin", "globex"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(store.Tenant("globex")) != 0 || tinystore.Length(store.Tenant("acme")) != 1 {
+		t.Error("Should remove from its tenant only")
+		return
+	}
+
+	if e := store.Load(&DumyyItem{"a", "acme"}, &DumyyItem{"b", ""}); e != tinystore.ErrNoTenant {
+		t.Error("Load should fail")
+		return
+	}
+	if tinystore.Length(store) != 1 {
+		t.Error("Failed Load should change nothing")
+		return
+	}
+
+	acme := store.Tenant("acme")
+	if e := acme.Add(&DumyyItem{"intruder", "globex"}); !errors.Is(e, tinystore.ErrInvalidStoreItem) {
+		t.Errorf("Views should refuse other tenants' items: %v", e)
+		return
+	}
+	if e := acme.Load(&DumyyItem{"admin", "acme"}, &DumyyItem{"intruder", "globex"}); !errors.Is(e, tinystore.ErrInvalidStoreItem) {
+		t.Errorf("Views should not load other tenants' items: %v", e)
+		return
+	}
+	if tinystore.Length(acme) != 1 || len(store.Namespaces()) != 2 {
+		t.Error("Refused items should change nothing")
+		return
+	}
+}
+
+// Test_NamespacedStore_Quota
+func Test_NamespacedStore_Quota(t *testing.T) {
+
+	store := tinystore.NewNamespacedStore("tenants", tenantByPassword)
+	store.SetQuota("acme", 1)
+
+	if e := store.Add(&DumyyItem{"a", "acme"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := store.Add(&DumyyItem{"b", "acme"}); e != tinystore.ErrQuotaExceeded {
+		t.Error("Should exceed quota")
+		return
+	}
+	if e := store.Tenant("acme").Load(&DumyyItem{"a", "acme"}, &DumyyItem{"b", "acme"}); e != tinystore.ErrQuotaExceeded {
+		t.Error("Load should exceed quota")
+		return
+	}
+	if e := store.Add(&DumyyItem{"b", "globex"}); e != nil {
+		t.Error("Other tenants are not limited")
+		return
+	}
+
+	store.SetQuota("acme", -1)
+	if e := store.Add(&DumyyItem{"b", "acme"}); e != nil {
+		t.Error("Quota should be removed")
+		return
+	}
+
+	store.SetQuota("closed", 0)
+	if e := store.Add(&DumyyItem{"c", "closed"}); e != tinystore.ErrQuotaExceeded {
+		t.Error("Should exceed quota")
+		return
+	}
+	if e := store.Tenant("invalid").Add(&DumyyItem{}); e == nil {
+		t.Error("Should not add invalid items")
+		return
+	}
+	if ns := store.Namespaces(); len(ns) != 2 {
+		t.Errorf("Failed adds should not create tenants: %v", ns)
+		return
+	}
+}
+
+// Test_NamespacedStore_CopyDrop
+func Test_NamespacedStore_CopyDrop(t *testing.T) {
+
+	store := tinystore.NewNamespacedStore("tenants", nil)
+	store.Tenant("template").Load(&DumyyItem{"admin", "default"}, &DumyyItem{"guest", "default"})
+
+	if e := store.Copy("template", "acme"); e != nil {
+		t.Error(e)
+		return
+	}
+	store.Tenant("acme").ForEachWhere(NameFilter("admin"), reversePassword)
+	if x, _ := tinystore.FindByKey(store.Tenant("template"), "admin"); AsCredential(x).Password != "default" {
+		t.Error("Copy should clone items")
+		return
+	}
+
+	store.SetQuota("small", 1)
+	if e := store.Copy("template", "small"); e != tinystore.ErrQuotaExceeded {
+		t.Error("Copy should respect quota")
+		return
+	}
+	if e := store.Copy("nothing", "acme"); e != tinystore.ErrNotFound {
+		t.Error("Should not find source")
+		return
+	}
+
+	if e := store.Drop("template"); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := store.Drop("template"); e != tinystore.ErrNotFound {
+		t.Error("Should be dropped")
+		return
+	}
+	if ns := store.Namespaces(); len(ns) != 1 || ns[0] != "acme" {
+		t.Errorf("Bad namespaces: %v", ns)
+		return
+	}
+}
+
+// Test_NamespacedStore_LoadJson tenant views use the adapter registered for the parent
+func Test_NamespacedStore_LoadJson(t *testing.T) {
+
+	store := tinystore.NewNamespacedStore("NamespacedStore", nil)
+	tinystore.RegisterStoreAdapter(store, tinystore.NewDefaultStoreItemAdapter(convert))
+
+	acme := store.Tenant("acme")
+	if e := tinystore.LoadJsonFile(acme, "testdata/credentials.json"); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(acme) != 2 || tinystore.Length(store.Tenant("globex")) != 0 {
+		t.Error("LoadJson Failed")
+		return
+	}
+	if _, exists := tinystore.LookupAdapter(acme.GetName()); exists {
+		t.Error("Other stores should not fall back to the parent adapter")
+		return
+	}
+}
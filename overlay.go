@@ -0,0 +1,255 @@
+package tinystore
+
+import (
+	"sync"
+)
+
+// OverlayStore stacks Store layers, reads resolve keys top down, writes go to the top layer.
+// Removing an item coming from a lower layer records a tombstone hiding the key in lower layers,
+// lower layers are never written. Items copied up from lower layers by mutators are cloned first
+// if they implement Cloner
+type OverlayStore struct {
+	mutex      sync.Mutex
+	top        Store
+	lower      []Store
+	tombstones map[interface{}]bool
+}
+
+// NewOverlayStore returns an OverlayStore writing to top over lower, highest first
+func NewOverlayStore(top Store, lower ...Store) *OverlayStore {
+	return &OverlayStore{top: top, lower: lower, tombstones: make(map[interface{}]bool)}
+}
+
+// Tombstones keys hidden in lower layers
+func (s *OverlayStore) Tombstones() []interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]interface{}, 0, len(s.tombstones))
+	for key := range s.tombstones {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// layered an item and whether it comes from the top layer
+type layered struct {
+	item  StoreItem
+	inTop bool
+}
+
+// resolve returns the visible items, top layer first, caller holds the lock
+func (s *OverlayStore) resolve() []layered {
+	seen := make(map[interface{}]bool)
+	result := make([]layered, 0)
+	for _, item := range s.top.All() {
+		seen[item.GetKey()] = true
+		result = append(result, layered{item, true})
+	}
+	for _, layer := range s.lower {
+		for _, item := range layer.All() {
+			key := item.GetKey()
+			if seen[key] || s.tombstones[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, layered{item, false})
+		}
+	}
+	return result
+}
+
+// inLower returns true if any lower layer has key, caller holds the lock
+func (s *OverlayStore) inLower(key interface{}) bool {
+	for _, layer := range s.lower {
+		if _, e := FindByKey(layer, key); e == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// remove hides a visible item, caller holds the lock
+func (s *OverlayStore) remove(x layered) error {
+	if x.inTop {
+		if e := s.top.Remove(x.item); e != nil {
+			return e
+		}
+	}
+	if s.inLower(x.item.GetKey()) {
+		s.tombstones[x.item.GetKey()] = true
+	}
+	return nil
+}
+
+// write puts item in the top layer replacing its key, caller holds the lock
+func (s *OverlayStore) write(item StoreItem, inTop bool) error {
+	if inTop {
+		if updater, ok := s.top.(Updater); ok {
+			return updater.Upsert(item)
+		}
+		if e := s.top.RemoveWhere(KeyEqualsFilter(item.GetKey())); e != nil {
+			return e
+		}
+	}
+	return s.top.Add(item)
+}
+
+// mutate applies transform to visible items matching filter, copying lower items up,
+// caller holds the lock
+func (s *OverlayStore) mutate(filter Filter, transform Mutator) (bool, error) {
+	found := false
+	for _, x := range s.resolve() {
+		if !filter(x.item) {
+			continue
+		}
+		found = true
+		item := x.item
+		if cloner, ok := item.(Cloner); ok && !x.inTop {
+			item = cloner.Clone()
+		}
+		result, e := transform(item)
+		if e != nil {
+			return found, e
+		}
+		if e := s.write(result, x.inTop); e != nil {
+			return found, e
+		}
+	}
+	return found, nil
+}
+
+// Flatten merges the visible items into a new SimpleStore
+func (s *OverlayStore) Flatten() *SimpleStore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	flat := &SimpleStore{Name: s.top.GetName()}
+	for _, x := range s.resolve() {
+		flat.Add(x.item)
+	}
+	return flat
+}
+
+// GetName implements Store.GetName, the top layer name
+func (s *OverlayStore) GetName() string {
+	return s.top.GetName()
+}
+
+// All implements Store.All
+func (s *OverlayStore) All() []StoreItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resolved := s.resolve()
+	items := make([]StoreItem, len(resolved))
+	for i, x := range resolved {
+		items[i] = x.item
+	}
+	return items
+}
+
+// Find implements Store.Find
+func (s *OverlayStore) Find(filter Filter) (StoreItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, x := range s.resolve() {
+		if filter(x.item) {
+			return x.item, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Add implements Store.Add, to the top layer
+func (s *OverlayStore) Add(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, x := range s.resolve() {
+		if x.item.GetKey() == item.GetKey() {
+			return ErrAlreadyExists
+		}
+	}
+	if e := s.top.Add(item); e != nil {
+		return e
+	}
+	delete(s.tombstones, item.GetKey())
+	return nil
+}
+
+// Remove implements Store.Remove
+func (s *OverlayStore) Remove(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, x := range s.resolve() {
+		if x.item.GetKey() == item.GetKey() {
+			return s.remove(x)
+		}
+	}
+	return ErrNotFound
+}
+
+// Clear implements Store.Clear, tombstones every lower key
+func (s *OverlayStore) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.top.Clear()
+	for _, layer := range s.lower {
+		for _, item := range layer.All() {
+			s.tombstones[item.GetKey()] = true
+		}
+	}
+}
+
+// Load implements Store.Load, items replace every layer's
+func (s *OverlayStore) Load(items ...StoreItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.top.Load(items...); e != nil {
+		return e
+	}
+	for _, layer := range s.lower {
+		for _, item := range layer.All() {
+			s.tombstones[item.GetKey()] = true
+		}
+	}
+	return nil
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *OverlayStore) RemoveWhere(filter Filter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var e error = ErrNotFound
+	for _, x := range s.resolve() {
+		if !filter(x.item) {
+			continue
+		}
+		if e = s.remove(x); e != nil {
+			return e
+		}
+	}
+	return e
+}
+
+// ForEach implements Store.ForEach, mutated lower items are written to the top layer
+func (s *OverlayStore) ForEach(f Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, e := s.mutate(Always, f)
+	return e
+}
+
+// ForEachWhere implements Store.ForEachWhere, mutated lower items are written to the top layer
+func (s *OverlayStore) ForEachWhere(filter Filter, transform Mutator) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	found, e := s.mutate(filter, transform)
+	if !found {
+		return ErrNotFound
+	}
+	return e
+}
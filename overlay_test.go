@@ -0,0 +1,80 @@
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_OverlayStore
+func Test_OverlayStore(t *testing.T) {
+
+	base := &tinystore.SimpleStore{Name: "base"}
+	base.Load(&DumyyItem{"admin", "default"}, &DumyyItem{"guest", "default"}, &DumyyItem{"root", "default"})
+	env := &tinystore.SimpleStore{Name: "env"}
+	env.Load(&DumyyItem{"admin", "env"})
+	top := &tinystore.SimpleStore{Name: "top"}
+
+	store := tinystore.NewOverlayStore(top, env, base)
+
+	if tinystore.Length(store) != 3 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "admin"); AsCredential(x).Password != "env" {
+		t.Error("Should resolve top down")
+		return
+	}
+
+	if e := store.Add(&DumyyItem{"guest", "1234"}); e != tinystore.ErrAlreadyExists {
+		t.Error("Should exist in a lower layer")
+		return
+	}
+	if e := store.Add(&DumyyItem{"me", "1234"}); e != nil || tinystore.Length(top) != 1 {
+		t.Error("Should write the top layer")
+		return
+	}
+
+	if e := store.Remove(&DumyyItem{"guest", "x"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "guest"); e != tinystore.ErrNotFound || tinystore.Length(base) != 3 {
+		t.Error("Should be hidden by a tombstone")
+		return
+	}
+	if len(store.Tombstones()) != 1 {
+		t.Error("Bad tombstones")
+		return
+	}
+
+	if e := store.ForEachWhere(NameFilter("root"), reversePassword); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "root"); AsCredential(x).Password != "tluafed" {
+		t.Error("ForEachWhere failed")
+		return
+	}
+	if x, _ := tinystore.FindByKey(base, "root"); AsCredential(x).Password != "default" {
+		t.Error("Lower layer changed")
+		return
+	}
+
+	// guest comes back once added again
+	store.Add(&DumyyItem{"guest", "1234"})
+	flat := store.Flatten()
+	if tinystore.Length(flat) != 4 || flat.GetName() != "top" {
+		t.Errorf("Bad Flatten: %v", flat.All())
+		return
+	}
+	for key, password := range map[string]string{"admin": "env", "guest": "1234", "root": "tluafed", "me": "1234"} {
+		if x, e := tinystore.FindByKey(flat, key); e != nil || AsCredential(x).Password != password {
+			t.Errorf("Bad %v", key)
+		}
+	}
+
+	store.Clear()
+	if tinystore.Length(store) != 0 || tinystore.Length(base) != 3 {
+		t.Error("Clear failed")
+	}
+}
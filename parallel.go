@@ -0,0 +1,138 @@
+package tinystore
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelError item errors collected by ParallelForEachCollect, in store order
+type ParallelError struct {
+	Failed []BatchItemResult
+}
+
+// Error implements error interface
+func (e *ParallelError) Error() string {
+	return fmt.Sprintf("%d items failed, first: %v", len(e.Failed), e.Failed[0].Err)
+}
+
+// Unwrap returns the item errors
+func (e *ParallelError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, failed := range e.Failed {
+		errs[i] = failed.Err
+	}
+	return errs
+}
+
+// parallel calls f(i) for i in [0, n) from workers goroutines, stops handing out work once f returns false
+func parallel(n int, workers int, f func(i int) bool) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	var next int64 = -1
+	var stop int32
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				if !f(i) {
+					atomic.StoreInt32(&stop, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ParallelWhere as Where with filter calls spread over workers goroutines,
+// items keep the store order, workers < 1 means runtime.GOMAXPROCS
+func ParallelWhere(store Store, filter Filter, workers int) (items []StoreItem, count int) {
+	all := store.All()
+	matches := make([]bool, len(all))
+	parallel(len(all), workers, func(i int) bool {
+		matches[i] = filter(all[i])
+		return true
+	})
+	for i, match := range matches {
+		if match {
+			items = append(items, all[i])
+			count++
+		}
+	}
+	return items, count
+}
+
+// ParallelForEach as ForEach with mutator calls spread over workers goroutines,
+// stops at the first mutator error leaving the store unchanged,
+// otherwise loads every item, mutated or not, in the original order at once.
+// Filter is optional, workers < 1 means runtime.GOMAXPROCS.
+// Versioned stores return ErrVersionConflict and are left unchanged if they changed while mutators ran,
+// the check and the load are atomic for RevisionLoader stores. Changes made to other stores meanwhile are lost
+func ParallelForEach(store Store, mutator Mutator, filter Filter, workers int) error {
+	return parallelForEach(store, mutator, filter, workers, false)
+}
+
+// ParallelForEachCollect as ParallelForEach but runs every item,
+// returns a *ParallelError with every failure and leaves the store unchanged if any failed
+func ParallelForEachCollect(store Store, mutator Mutator, filter Filter, workers int) error {
+	return parallelForEach(store, mutator, filter, workers, true)
+}
+
+func parallelForEach(store Store, mutator Mutator, filter Filter, workers int, collect bool) error {
+
+	// taken before All, a change in between is a conflict
+	versioned, isVersioned := store.(Versioned)
+	var revision uint64
+	if isVersioned {
+		revision = versioned.Revision()
+	}
+	all := store.All()
+	results := make([]StoreItem, len(all))
+	errs := make([]error, len(all))
+	var found int32
+
+	parallel(len(all), workers, func(i int) bool {
+		item := all[i]
+		if filter != nil && !filter(item) {
+			results[i] = item
+			return true
+		}
+		atomic.StoreInt32(&found, 1)
+		results[i], errs[i] = mutator(item)
+		return collect || errs[i] == nil
+	})
+
+	failed := make([]BatchItemResult, 0)
+	for i, e := range errs {
+		if e != nil {
+			failed = append(failed, BatchItemResult{Key: all[i].GetKey(), Err: e})
+		}
+	}
+	if len(failed) > 0 {
+		if collect {
+			return &ParallelError{Failed: failed}
+		}
+		return failed[0].Err
+	}
+	if found == 0 {
+		return ErrNotFound
+	}
+	if loader, ok := store.(RevisionLoader); ok && isVersioned {
+		return loader.LoadRevision(revision, results...)
+	}
+	if isVersioned && versioned.Revision() != revision {
+		return ErrVersionConflict
+	}
+	return store.Load(results...)
+}
@@ -0,0 +1,141 @@
+package tinystore_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+func loadNumbered(store tinystore.Store, n int) {
+	items := make([]tinystore.StoreItem, n)
+	for i := range items {
+		items[i] = &DumyyItem{fmt.Sprint(i), "1234"}
+	}
+	store.Load(items...)
+}
+
+// Test_ParallelWhere
+func Test_ParallelWhere(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 1000)
+
+	even := func(item tinystore.StoreItem) bool {
+		var i int
+		fmt.Sscan(AsCredentialGetName(item), &i)
+		return i%2 == 0
+	}
+
+	items, count := tinystore.ParallelWhere(store, even, 8)
+	expected, expectedCount := tinystore.Where(store, even)
+	if count != expectedCount || len(items) != len(expected) {
+		t.Errorf("Bad count: %v", count)
+		return
+	}
+	for i := range items {
+		if items[i] != expected[i] {
+			t.Errorf("Order not kept at %v", i)
+			return
+		}
+	}
+}
+
+// Test_ParallelForEach
+func Test_ParallelForEach(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 1000)
+
+	e := tinystore.ParallelForEach(store, func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{AsCredentialGetName(item), "abcd"}, nil
+	}, NameFilter("5"), 8)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(store) != 1000 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+	for i, item := range store.All() {
+		expected := "1234"
+		if i == 5 {
+			expected = "abcd"
+		}
+		if AsCredentialGetName(item) != fmt.Sprint(i) || AsCredential(item).Password != expected {
+			t.Errorf("Bad item at %v: %v", i, item)
+			return
+		}
+	}
+
+	if e := tinystore.ParallelForEach(store, reversePassword, NameFilter("nobody"), 8); e != tinystore.ErrNotFound {
+		t.Error("Should be NotFound")
+	}
+}
+
+// Test_ParallelForEach_Errors
+func Test_ParallelForEach_Errors(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 100)
+
+	failOdd := func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		var i int
+		fmt.Sscan(AsCredentialGetName(item), &i)
+		if i%2 == 1 {
+			return nil, tinystore.ErrInvalidStoreItem
+		}
+		return &DumyyItem{AsCredentialGetName(item), "abcd"}, nil
+	}
+
+	if e := tinystore.ParallelForEach(store, failOdd, nil, 4); e != tinystore.ErrInvalidStoreItem {
+		t.Errorf("Should fail: %v", e)
+		return
+	}
+
+	e := tinystore.ParallelForEachCollect(store, failOdd, nil, 4)
+	var parallelError *tinystore.ParallelError
+	if !errors.As(e, &parallelError) || len(parallelError.Failed) != 50 || !errors.Is(e, tinystore.ErrInvalidStoreItem) {
+		t.Errorf("Should collect every error: %v", e)
+		return
+	}
+	if parallelError.Failed[0].Key != "1" {
+		t.Error("Errors not in store order")
+	}
+
+	for _, item := range store.All() {
+		if AsCredential(item).Password != "1234" {
+			t.Error("Failed ForEach applied")
+			return
+		}
+	}
+}
+
+// Test_ParallelForEach_Conflict
+func Test_ParallelForEach_Conflict(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	loadNumbered(store, 100)
+
+	once := sync.Once{}
+	e := tinystore.ParallelForEach(store, func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		once.Do(func() {
+			store.Add(&DumyyItem{"late", "1234"})
+		})
+		return &DumyyItem{AsCredentialGetName(item), "abcd"}, nil
+	}, nil, 8)
+	if e != tinystore.ErrVersionConflict {
+		t.Errorf("Should conflict: %v", e)
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "late"); e != nil || tinystore.Length(store) != 101 {
+		t.Error("Concurrent Add should not be lost")
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "0"); AsCredential(x).Password != "1234" {
+		t.Error("Nothing should be loaded")
+		return
+	}
+}
@@ -0,0 +1,43 @@
+package tinystore
+
+// MergePatch applies patch to target as described by RFC 7386 (JSON Merge Patch),
+// nil values remove keys, nested objects are merged recursively, anything else replaces.
+// target is modified and returned
+func MergePatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]interface{}); ok {
+			targetObject, _ := target[key].(map[string]interface{})
+			target[key] = MergePatch(targetObject, patchObject)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
+
+// ToMap converts item to its json document representation, Secret and tagged fields are masked,
+// see ToMapOf for fields marked secret by a store adapter
+func ToMap(item StoreItem) (map[string]interface{}, error) {
+	return document(item, maskSecrets, nil)
+}
+
+// ToMapOf converts an item of store like ToMap, also masking the fields its adapter marks secret, see WithSecretFields
+func ToMapOf(store Store, item StoreItem) (map[string]interface{}, error) {
+	return document(item, maskSecrets, secretKeysOf(adapterName(store)))
+}
+
+// PatchItem applies a merge patch to item and converts the result back with adapter
+func PatchItem(adapter StoreItemAdapter, item StoreItem, patch map[string]interface{}) (StoreItem, error) {
+	doc, e := document(item, rawSecrets, nil)
+	if e != nil {
+		return nil, e
+	}
+	return adapter.Convert(MergePatch(doc, patch)), nil
+}
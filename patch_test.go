@@ -0,0 +1,42 @@
+package tinystore_test
+
+import (
+	"reflect"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_MergePatch
+func Test_MergePatch(t *testing.T) {
+
+	target := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+	}
+	patch := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"f": nil},
+		"h": "i",
+	}
+	expected := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"d": "e"},
+		"h": "i",
+	}
+	if result := tinystore.MergePatch(target, patch); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v got %v", expected, result)
+	}
+}
+
+// Test_PatchItem
+func Test_PatchItem(t *testing.T) {
+	adapter := tinystore.NewDefaultStoreItemAdapter(convert)
+	result, e := tinystore.PatchItem(adapter, &DumyyItem{"me", "1234"}, map[string]interface{}{"Password": "abcd"})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if !AsCredential(result).Equals(&DumyyItem{"me", "abcd"}) {
+		t.Errorf("Bad patch result: %v", result)
+	}
+}
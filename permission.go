@@ -0,0 +1,374 @@
+package tinystore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operation a Store method, used by permission rules
+type Operation int
+
+const (
+	OpLoad Operation = iota
+	OpAll
+	OpFind
+	OpAdd
+	OpRemove
+	OpClear
+	OpRemoveWhere
+	OpForEach
+	OpForEachWhere
+)
+
+var operationNames = [...]string{"Load", "All", "Find", "Add", "Remove", "Clear", "RemoveWhere", "ForEach", "ForEachWhere"}
+
+// String returns the Store method name
+func (op Operation) String() string {
+	if op < 0 || int(op) >= len(operationNames) {
+		return "Unknown"
+	}
+	return operationNames[op]
+}
+
+// MarshalText implements encoding.TextMarshaler, the Store method name
+func (op Operation) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (op *Operation) UnmarshalText(text []byte) error {
+	for i, name := range operationNames {
+		if name == string(text) {
+			*op = Operation(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("tinystore: unknown operation %q", text)
+}
+
+// readOnlyStore Store view rejecting mutators
+type readOnlyStore struct {
+	store Store
+}
+
+// ReadOnly returns a view of store whose mutators return ErrReadOnly, Clear does nothing
+func ReadOnly(store Store) Store {
+	return &readOnlyStore{store: store}
+}
+
+func (s *readOnlyStore) GetName() string {
+	return s.store.GetName()
+}
+
+func (s *readOnlyStore) All() []StoreItem {
+	return s.store.All()
+}
+
+func (s *readOnlyStore) Find(filter Filter) (StoreItem, error) {
+	return s.store.Find(filter)
+}
+
+func (s *readOnlyStore) Load(items ...StoreItem) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Add(item StoreItem) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Remove(item StoreItem) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) Clear() {
+}
+
+func (s *readOnlyStore) RemoveWhere(filter Filter) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) ForEach(f Mutator) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return ErrReadOnly
+}
+
+// Rule allows Identity to call Operations on the items matching Filter
+type Rule struct {
+	// Identity the rule applies to, "" means anyone
+	Identity string
+	// Operations allowed, empty means every operation
+	Operations []Operation
+	// Filter items in scope, nil means every item. Load needs a rule without Filter
+	Filter Filter
+}
+
+// applies returns true if the rule covers identity calling op
+func (r Rule) applies(identity string, op Operation) bool {
+	if r.Identity != "" && r.Identity != identity {
+		return false
+	}
+	if len(r.Operations) == 0 {
+		return true
+	}
+	for _, allowed := range r.Operations {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy rules are additive, anything no rule allows is denied
+type Policy []Rule
+
+// scope returns the items identity may call op on, nil if every item, false if denied
+func (p Policy) scope(identity string, op Operation) (Filter, bool) {
+	filters := make([]Filter, 0)
+	for _, rule := range p {
+		if !rule.applies(identity, op) {
+			continue
+		}
+		if rule.Filter == nil {
+			return nil, true
+		}
+		filters = append(filters, rule.Filter)
+	}
+	if len(filters) == 0 {
+		return nil, false
+	}
+	return func(item StoreItem) bool {
+		for _, filter := range filters {
+			if filter(item) {
+				return true
+			}
+		}
+		return false
+	}, true
+}
+
+// Denial a call rejected by a PolicyStore
+type Denial struct {
+	Identity  string
+	Operation Operation
+	// Item out of scope, nil if the operation itself was denied
+	Item StoreItem
+	Time time.Time
+}
+
+// PolicyStore wraps a Store checking every call of Identity against Policy.
+// Reads and filtered mutators only see the items in scope, Add and Remove of items out of scope
+// and calls no rule allows fail with ErrPermissionDenied and are reported to OnDenied.
+// Denied All returns nothing, denied Clear does nothing
+type PolicyStore struct {
+	store    Store
+	identity string
+	policy   Policy
+
+	// OnDenied called for every denied call, set it before use
+	OnDenied func(denial Denial)
+	// Clock time source of denials, nil means time.Now
+	Clock Clock
+}
+
+// NewPolicyStore returns store as seen by identity under policy
+func NewPolicyStore(store Store, identity string, policy Policy) *PolicyStore {
+	return &PolicyStore{store: store, identity: identity, policy: policy}
+}
+
+// Identity the store calls are made as
+func (s *PolicyStore) Identity() string {
+	return s.identity
+}
+
+// deny reports a denied call, returns ErrPermissionDenied
+func (s *PolicyStore) deny(op Operation, item StoreItem) error {
+	if s.OnDenied != nil {
+		s.OnDenied(Denial{Identity: s.identity, Operation: op, Item: item, Time: s.Clock.Now()})
+	}
+	return ErrPermissionDenied
+}
+
+// allow returns the scope of op, or ErrPermissionDenied
+func (s *PolicyStore) allow(op Operation) (Filter, error) {
+	scope, ok := s.policy.scope(s.identity, op)
+	if !ok {
+		return nil, s.deny(op, nil)
+	}
+	return scope, nil
+}
+
+// allowItem returns ErrPermissionDenied unless op is allowed on item
+func (s *PolicyStore) allowItem(op Operation, item StoreItem) error {
+	scope, e := s.allow(op)
+	if e != nil {
+		return e
+	}
+	if scope != nil && !scope(item) {
+		return s.deny(op, item)
+	}
+	return nil
+}
+
+// within combines filter with scope
+func within(scope Filter, filter Filter) Filter {
+	if scope == nil {
+		return filter
+	}
+	return func(item StoreItem) bool {
+		return scope(item) && filter(item)
+	}
+}
+
+// GetName implements Store.GetName
+func (s *PolicyStore) GetName() string {
+	return s.store.GetName()
+}
+
+// All implements Store.All, the items in scope
+func (s *PolicyStore) All() []StoreItem {
+	scope, e := s.allow(OpAll)
+	if e != nil {
+		return make([]StoreItem, 0)
+	}
+	if scope == nil {
+		return s.store.All()
+	}
+	items, _ := Where(s.store, scope)
+	return items
+}
+
+// Find implements Store.Find, among the items in scope
+func (s *PolicyStore) Find(filter Filter) (StoreItem, error) {
+	scope, e := s.allow(OpFind)
+	if e != nil {
+		return nil, e
+	}
+	return s.store.Find(within(scope, filter))
+}
+
+// Add implements Store.Add
+func (s *PolicyStore) Add(item StoreItem) error {
+	if e := s.allowItem(OpAdd, item); e != nil {
+		return e
+	}
+	return s.store.Add(item)
+}
+
+// Remove implements Store.Remove, both item and the stored item must be in scope
+func (s *PolicyStore) Remove(item StoreItem) error {
+	if e := s.allowItem(OpRemove, item); e != nil {
+		return e
+	}
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	if stored, e := FindByKey(s.store, item.GetKey()); e == nil {
+		if e := s.allowItem(OpRemove, stored); e != nil {
+			return e
+		}
+	}
+	return s.store.Remove(item)
+}
+
+// Clear implements Store.Clear, removes only the items in scope
+func (s *PolicyStore) Clear() {
+	scope, e := s.allow(OpClear)
+	if e != nil {
+		return
+	}
+	if scope == nil {
+		s.store.Clear()
+		return
+	}
+	s.store.RemoveWhere(scope)
+}
+
+// Load implements Store.Load, it replaces every item so it needs a rule without Filter
+func (s *PolicyStore) Load(items ...StoreItem) error {
+	scope, e := s.allow(OpLoad)
+	if e != nil {
+		return e
+	}
+	if scope != nil {
+		return s.deny(OpLoad, nil)
+	}
+	return s.store.Load(items...)
+}
+
+// RemoveWhere implements Store.RemoveWhere, among the items in scope
+func (s *PolicyStore) RemoveWhere(filter Filter) error {
+	scope, e := s.allow(OpRemoveWhere)
+	if e != nil {
+		return e
+	}
+	return s.store.RemoveWhere(within(scope, filter))
+}
+
+// ForEach implements Store.ForEach, items out of scope are left as they are,
+// if any result moves out of scope the call is denied and nothing is changed
+func (s *PolicyStore) ForEach(f Mutator) error {
+	scope, e := s.allow(OpForEach)
+	if e != nil {
+		return e
+	}
+	if scope == nil {
+		return s.store.ForEach(f)
+	}
+	results, e := s.results(OpForEach, scope, scope, f)
+	if e != nil {
+		return e
+	}
+	return s.store.ForEach(func(item StoreItem) (StoreItem, error) {
+		if result, ok := results[keyString(item.GetKey())]; ok {
+			return result, nil
+		}
+		return item, nil
+	})
+}
+
+// results runs f on clones of the items matching target, Cloner items, returning the results by key,
+// before anything is changed: if f fails its error is returned, if any result is out of scope the call is denied
+func (s *PolicyStore) results(op Operation, scope Filter, target Filter, f Mutator) (map[string]StoreItem, error) {
+	items, _ := Where(s.store, target)
+	results := make(map[string]StoreItem, len(items))
+	for _, item := range items {
+		result, e := f(cloneItem(item))
+		if e != nil {
+			return nil, e
+		}
+		if result == nil || !scope(result) {
+			return nil, s.deny(op, result)
+		}
+		results[keyString(item.GetKey())] = result
+	}
+	return results, nil
+}
+
+// ForEachWhere implements Store.ForEachWhere, among the items in scope,
+// if any result moves out of scope the call is denied and nothing is changed
+func (s *PolicyStore) ForEachWhere(filter Filter, transform Mutator) error {
+	scope, e := s.allow(OpForEachWhere)
+	if e != nil {
+		return e
+	}
+	if scope == nil {
+		return s.store.ForEachWhere(filter, transform)
+	}
+	results, e := s.results(OpForEachWhere, scope, within(scope, filter), transform)
+	if e != nil {
+		return e
+	}
+	if len(results) == 0 {
+		return s.store.ForEachWhere(within(scope, filter), transform)
+	}
+	checked := func(item StoreItem) bool {
+		_, ok := results[keyString(item.GetKey())]
+		return ok
+	}
+	return s.store.ForEachWhere(checked, func(item StoreItem) (StoreItem, error) {
+		return results[keyString(item.GetKey())], nil
+	})
+}
@@ -0,0 +1,224 @@
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_ReadOnly
+func Test_ReadOnly(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	store.Load(&DumyyItem{"me", "1234"}, &DumyyItem{"you", "1234"})
+	view := tinystore.ReadOnly(store)
+
+	if tinystore.Length(view) != 2 || view.GetName() != "SimpleStore" {
+		t.Error("Should read")
+		return
+	}
+	if _, e := tinystore.FindByKey(view, "me"); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := view.Add(&DumyyItem{"el", "1234"}); e != tinystore.ErrReadOnly {
+		t.Error("Add should fail")
+		return
+	}
+	if e := view.RemoveWhere(tinystore.Always); e != tinystore.ErrReadOnly {
+		t.Error("RemoveWhere should fail")
+		return
+	}
+	if e := view.ForEach(reversePassword); e != tinystore.ErrReadOnly {
+		t.Error("ForEach should fail")
+		return
+	}
+	view.Clear()
+	if tinystore.Length(store) != 2 {
+		t.Error("Clear should do nothing")
+		return
+	}
+}
+
+// Test_PolicyStore
+func Test_PolicyStore(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	store.Load(&DumyyItem{"admin", "1234"}, &DumyyItem{"guest", "1234"}, &DumyyItem{"plugin-a", "1234"})
+
+	notAdmin := tinystore.NotFilter(NameFilter("admin"))
+	policy := tinystore.Policy{
+		{Operations: []tinystore.Operation{tinystore.OpAll, tinystore.OpFind}},
+		{Identity: "plugin", Operations: []tinystore.Operation{tinystore.OpAdd, tinystore.OpRemove, tinystore.OpForEach}, Filter: notAdmin},
+	}
+
+	denials := make([]tinystore.Denial, 0)
+	plugin := tinystore.NewPolicyStore(store, "plugin", policy)
+	plugin.OnDenied = func(denial tinystore.Denial) {
+		denials = append(denials, denial)
+	}
+
+	if tinystore.Length(plugin) != 3 {
+		t.Error("Should read everything")
+		return
+	}
+	if e := plugin.Add(&DumyyItem{"plugin-b", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := plugin.Remove(&DumyyItem{"admin", "x"}); e != tinystore.ErrPermissionDenied {
+		t.Error("Remove admin should be denied")
+		return
+	}
+	if e := plugin.RemoveWhere(tinystore.Always); e != tinystore.ErrPermissionDenied {
+		t.Error("RemoveWhere should be denied")
+		return
+	}
+	plugin.Clear()
+	if tinystore.Length(store) != 4 {
+		t.Error("Clear should be denied")
+		return
+	}
+
+	if e := plugin.ForEach(reversePassword); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "admin"); AsCredential(x).Password != "1234" {
+		t.Error("ForEach should skip items out of scope")
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "guest"); AsCredential(x).Password != "4321" {
+		t.Error("ForEach failed")
+		return
+	}
+
+	if len(denials) != 3 {
+		t.Errorf("Bad denials: %v", len(denials))
+		return
+	}
+	if denials[0].Operation != tinystore.OpRemove || AsCredential(denials[0].Item).Username != "admin" {
+		t.Error("Bad denial")
+		return
+	}
+	if denials[1].Operation.String() != "RemoveWhere" || denials[1].Identity != "plugin" || denials[1].Item != nil {
+		t.Error("Bad denial")
+		return
+	}
+
+	stranger := tinystore.NewPolicyStore(store, "stranger", policy)
+	if e := stranger.Add(&DumyyItem{"x", "1234"}); e != tinystore.ErrPermissionDenied {
+		t.Error("Add should be denied")
+		return
+	}
+}
+
+// Test_PolicyStore_Scope reads only see items in scope
+func Test_PolicyStore_Scope(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	store.Load(&DumyyItem{"admin", "1234"}, &DumyyItem{"guest", "1234"})
+
+	guest := tinystore.NewPolicyStore(store, "guest", tinystore.Policy{
+		{Identity: "guest", Filter: NameFilter("guest")},
+	})
+
+	if items := guest.All(); len(items) != 1 || AsCredential(items[0]).Username != "guest" {
+		t.Error("All should be scoped")
+		return
+	}
+	if _, e := tinystore.FindByKey(guest, "admin"); e != tinystore.ErrNotFound {
+		t.Error("Find should be scoped")
+		return
+	}
+	if e := guest.Load(&DumyyItem{"guest", "1234"}); e != tinystore.ErrPermissionDenied {
+		t.Error("Scoped Load should be denied")
+		return
+	}
+	guest.Clear()
+	if tinystore.Length(store) != 1 {
+		t.Error("Clear should remove items in scope only")
+		return
+	}
+}
+
+// Test_PolicyStore_ScopeEscape
+func Test_PolicyStore_ScopeEscape(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	store.Load(&DumyyItem{"admin", "1234"}, &DumyyItem{"guest", "1234"})
+
+	var denials []tinystore.Denial
+	guest := tinystore.NewPolicyStore(store, "guest", tinystore.Policy{
+		{Identity: "guest", Filter: NameFilter("guest")},
+	})
+	guest.OnDenied = func(denial tinystore.Denial) {
+		denials = append(denials, denial)
+	}
+
+	// changed in place
+	e := guest.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		item.(*DumyyItem).Username = "root"
+		return item, nil
+	})
+	if e != tinystore.ErrPermissionDenied || len(denials) != 1 || denials[0].Operation != tinystore.OpForEach {
+		t.Errorf("Should deny results out of scope: %v", e)
+		return
+	}
+	e = guest.ForEachWhere(tinystore.Always, func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"root", "1234"}, nil
+	})
+	if e != tinystore.ErrPermissionDenied || len(denials) != 2 {
+		t.Errorf("Should deny results out of scope: %v", e)
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "guest"); e != nil || tinystore.Length(store) != 2 {
+		t.Error("Store should be unchanged")
+		return
+	}
+
+	if e := guest.ForEachWhere(tinystore.Always, reversePassword); e != nil {
+		t.Errorf("Results in scope should be allowed: %v", e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "guest"); AsCredential(x).Password != "4321" {
+		t.Error("Should apply the change")
+		return
+	}
+}
+
+// Test_PolicyStore_ForEachAtomic
+func Test_PolicyStore_ForEachAtomic(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "SimpleStore"}
+	store.Load(&DumyyItem{"a", "12"}, &DumyyItem{"b", "34"}, &DumyyItem{"c", "56"})
+	user := tinystore.NewPolicyStore(store, "user", tinystore.Policy{
+		{Identity: "user", Filter: func(item tinystore.StoreItem) bool {
+			return item.(*DumyyItem).Password != "locked"
+		}},
+	})
+	lockB := func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		if item.GetKey() == "b" {
+			return &DumyyItem{"b", "locked"}, nil
+		}
+		return reversePassword(item)
+	}
+
+	if e := user.ForEach(lockB); e != tinystore.ErrPermissionDenied {
+		t.Errorf("Should deny: %v", e)
+		return
+	}
+	if e := user.ForEachWhere(tinystore.Always, lockB); e != tinystore.ErrPermissionDenied {
+		t.Errorf("Should deny: %v", e)
+		return
+	}
+	for key, password := range map[string]string{"a": "12", "b": "34", "c": "56"} {
+		if item, _ := tinystore.FindByKey(store, key); item.(*DumyyItem).Password != password {
+			t.Errorf("%s should be unchanged", key)
+			return
+		}
+	}
+	if e := user.ForEach(reversePassword); e != nil || passwords(store) != "214365" {
+		t.Errorf("Should apply every change: %v", e)
+		return
+	}
+}
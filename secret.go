@@ -0,0 +1,349 @@
+package tinystore
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// secretPrefix of sealed values, followed by "<key id>:<base64 nonce and ciphertext>"
+	secretPrefix = "tinystore:secret:v1:"
+	// masked what secrets look like outside the store
+	masked = "***"
+)
+
+// Secret a string field value that never leaves the package in clear: it prints and marshals as "***",
+// SaveJson stores it encrypted with the key set by SetSecretKey and LoadJson keeps it encrypted
+// until Reveal is called. Prefer it for secret fields, Credential.Password is one.
+// Plain string fields tagged `tinystore:"secret"`, for types whose fields can't be Secrets, are only
+// protected at rest: SaveJson encrypts them, LoadJson decrypts them and ToMap masks them,
+// fmt and encoding/json can't. Fields marked by WithSecretFields are masked by ToMapOf
+type Secret string
+
+// String implements fmt.Stringer, masked
+func (s Secret) String() string {
+	return masked
+}
+
+// GoString implements fmt.GoStringer, masked
+func (s Secret) GoString() string {
+	return `"` + masked + `"`
+}
+
+// MarshalJSON implements json.Marshaler, masked
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(masked)
+}
+
+// Sealed returns true if the value is still encrypted
+func (s Secret) Sealed() bool {
+	return strings.HasPrefix(string(s), secretPrefix)
+}
+
+// Reveal returns the clear value, decrypting it if sealed
+func (s Secret) Reveal() (string, error) {
+	if !s.Sealed() {
+		return string(s), nil
+	}
+	return openSecret(string(s))
+}
+
+// SecretFielder is implemented by adapters marking document keys as secret
+type SecretFielder interface {
+	SecretFields() []string
+}
+
+type secretAdapter struct {
+	StoreItemAdapter
+	fields []string
+}
+
+// WithSecretFields returns adapter marking the document keys fields as secret, for items
+// whose fields can't be tagged. Their values are encrypted by SaveJson and decrypted by LoadJson
+// before conversion
+func WithSecretFields(adapter StoreItemAdapter, fields ...string) StoreItemAdapter {
+	return &secretAdapter{StoreItemAdapter: adapter, fields: fields}
+}
+
+func (a *secretAdapter) SecretFields() []string {
+	return a.fields
+}
+
+var secretKey struct {
+	sync.RWMutex
+	provider KeyProvider
+}
+
+// SetSecretKey sets the key secrets are encrypted with, nil removes it.
+// The provider must return a key for nil KDFParams, a Keyring seals with its current key
+// and opens with the key that sealed
+func SetSecretKey(provider KeyProvider) {
+	secretKey.Lock()
+	defer secretKey.Unlock()
+	secretKey.provider = provider
+}
+
+func secretProvider() (KeyProvider, error) {
+	secretKey.RLock()
+	defer secretKey.RUnlock()
+	if secretKey.provider == nil {
+		return nil, ErrNoSecretKey
+	}
+	return secretKey.provider, nil
+}
+
+// sealSecret encrypts clear, empty and sealed values are returned as they are
+func sealSecret(clear string) (string, error) {
+	if clear == "" || strings.HasPrefix(clear, secretPrefix) {
+		return clear, nil
+	}
+	provider, e := secretProvider()
+	if e != nil {
+		return "", e
+	}
+	id := ""
+	if ring, ok := provider.(*Keyring); ok {
+		id = ring.Current()
+		provider = ring.lookup(id)
+	}
+	key, e := provider.Key(nil)
+	if e != nil {
+		return "", e
+	}
+	gcm, e := newGCM(key)
+	if e != nil {
+		return "", e
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, e := rand.Read(nonce); e != nil {
+		return "", e
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(clear), []byte(id))
+	return secretPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a sealed value
+func openSecret(sealed string) (string, error) {
+	provider, e := secretProvider()
+	if e != nil {
+		return "", e
+	}
+	rest := strings.TrimPrefix(sealed, secretPrefix)
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", ErrInvalidEncryptedData
+	}
+	id := rest[:i]
+	data, e := base64.StdEncoding.DecodeString(rest[i+1:])
+	if e != nil {
+		return "", ErrInvalidEncryptedData.Wrap(e)
+	}
+	if ring, ok := provider.(*Keyring); ok {
+		if provider = ring.lookup(id); provider == nil {
+			return "", ErrDecryptionFailed.Wrap(fmt.Errorf("unknown key %s", id))
+		}
+	}
+	key, e := provider.Key(nil)
+	if e != nil {
+		return "", e
+	}
+	gcm, e := newGCM(key)
+	if e != nil {
+		return "", e
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrInvalidEncryptedData
+	}
+	clear, e := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(id))
+	if e != nil {
+		return "", ErrDecryptionFailed
+	}
+	return string(clear), nil
+}
+
+// secretField a struct field holding a secret, index in the struct and document key
+type secretField struct {
+	index  int
+	name   string
+	secret bool
+}
+
+var secretFieldsCache sync.Map
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// secretFields returns the secret fields of structs and pointers to structs
+func secretFields(t reflect.Type) []secretField {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if cached, ok := secretFieldsCache.Load(t); ok {
+		return cached.([]secretField)
+	}
+	fields := make([]secretField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		isSecret := field.Type == secretType
+		if !isSecret && (field.Type.Kind() != reflect.String || field.Tag.Get("tinystore") != "secret") {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, secretField{index: i, name: name, secret: isSecret})
+	}
+	secretFieldsCache.Store(t, fields)
+	return fields
+}
+
+// structOf returns the struct value of item, false if it isn't a struct or pointer to one
+func structOf(item StoreItem) (reflect.Value, bool) {
+	value := reflect.ValueOf(item)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return value, false
+		}
+		value = value.Elem()
+	}
+	return value, value.Kind() == reflect.Struct
+}
+
+// secretMode what document does with secret values
+type secretMode int
+
+const (
+	maskSecrets secretMode = iota
+	rawSecrets
+	sealSecrets
+)
+
+// document converts item to its json document, secret fields and keys are masked, kept as stored or sealed
+func document(item StoreItem, mode secretMode, keys []string) (map[string]interface{}, error) {
+	bytes, e := json.Marshal(item)
+	if e != nil {
+		return nil, e
+	}
+	doc := make(map[string]interface{})
+	if e = json.Unmarshal(bytes, &doc); e != nil {
+		return nil, e
+	}
+	apply := func(name string, value string) error {
+		if _, exists := doc[name]; !exists {
+			return nil
+		}
+		switch mode {
+		case maskSecrets:
+			doc[name] = masked
+		case rawSecrets:
+			doc[name] = value
+		case sealSecrets:
+			sealed, e := sealSecret(value)
+			if e != nil {
+				return e
+			}
+			doc[name] = sealed
+		}
+		return nil
+	}
+	if value, ok := structOf(item); ok {
+		for _, field := range secretFields(value.Type()) {
+			if e := apply(field.name, value.Field(field.index).String()); e != nil {
+				return nil, e
+			}
+		}
+	}
+	for _, key := range keys {
+		if value, ok := doc[key].(string); ok {
+			if e := apply(key, value); e != nil {
+				return nil, e
+			}
+		}
+	}
+	return doc, nil
+}
+
+// hasSecrets returns true if item has secret fields
+func hasSecrets(item StoreItem) bool {
+	value, ok := structOf(item)
+	return ok && len(secretFields(value.Type())) > 0
+}
+
+// secretKeysOf returns the document keys the adapter of name marks secret
+func secretKeysOf(name string) []string {
+	if adapter, exists := LookupAdapter(name); exists {
+		if fielder, ok := adapter.(SecretFielder); ok {
+			return fielder.SecretFields()
+		}
+	}
+	return nil
+}
+
+// sealDocuments returns items ready to be marshalled with their secrets sealed
+func sealDocuments(name string, items []StoreItem) ([]interface{}, error) {
+	keys := secretKeysOf(name)
+	docs := make([]interface{}, len(items))
+	for i, item := range items {
+		if len(keys) == 0 && !hasSecrets(item) {
+			docs[i] = item
+			continue
+		}
+		doc, e := document(item, sealSecrets, keys)
+		if e != nil {
+			return nil, e
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// openDocuments decrypts the sealed values of keys in docs
+func openDocuments(docs []map[string]interface{}, keys []string) error {
+	for _, doc := range docs {
+		for _, key := range keys {
+			if value, ok := doc[key].(string); ok && strings.HasPrefix(value, secretPrefix) {
+				clear, e := openSecret(value)
+				if e != nil {
+					return e
+				}
+				doc[key] = clear
+			}
+		}
+	}
+	return nil
+}
+
+// openItem decrypts the sealed tagged string fields of item, Secret fields stay sealed until Reveal
+func openItem(item StoreItem) error {
+	value, ok := structOf(item)
+	if !ok || !value.CanSet() {
+		return nil
+	}
+	for _, field := range secretFields(value.Type()) {
+		target := value.Field(field.index)
+		if field.secret || !strings.HasPrefix(target.String(), secretPrefix) {
+			continue
+		}
+		clear, e := openSecret(target.String())
+		if e != nil {
+			return e
+		}
+		target.SetString(clear)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package tinystore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// account has a Secret and a tagged secret field, test only
+type account struct {
+	Username string
+	Token    tinystore.Secret
+	Password string `tinystore:"secret" json:"password"`
+}
+
+func (a *account) Valid() bool {
+	return a != nil && a.Username != ""
+}
+
+func (a *account) Validate() error {
+	if a.Valid() {
+		return nil
+	}
+	return tinystore.ErrInvalidStoreItem
+}
+
+func (a *account) GetKey() interface{} {
+	return a.Username
+}
+
+func convertAccount(item map[string]interface{}) tinystore.StoreItem {
+	result := &account{}
+	result.Username, _ = GetString(item, "Username")
+	token, _ := GetString(item, "Token")
+	result.Token = tinystore.Secret(token)
+	result.Password, _ = GetString(item, "password")
+	return result
+}
+
+func AsAccount(item tinystore.StoreItem) *account {
+	return item.(*account)
+}
+
+func accountStore() *tinystore.SimpleStore {
+	store := &tinystore.SimpleStore{Name: "Accounts"}
+	tinystore.RegisterStoreAdapter(store, tinystore.NewDefaultStoreItemAdapter(convertAccount))
+	store.Add(&account{Username: "me", Token: "t0k3n", Password: "P@55w0rd!"})
+	return store
+}
+
+// Test_Secret_Masked
+func Test_Secret_Masked(t *testing.T) {
+
+	item := &account{Username: "me", Token: "t0k3n", Password: "P@55w0rd!"}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if text := fmt.Sprintf(format, *item); strings.Contains(text, "t0k3n") {
+			t.Errorf("%s should mask: %s", format, text)
+			return
+		}
+	}
+	if bytes, _ := json.Marshal(item); strings.Contains(string(bytes), "t0k3n") {
+		t.Errorf("json should mask: %s", bytes)
+		return
+	}
+	doc, _ := tinystore.ToMap(item)
+	if doc["Token"] != "***" || doc["password"] != "***" || doc["Username"] != "me" {
+		t.Errorf("ToMap should mask: %v", doc)
+		return
+	}
+	if clear, _ := item.Token.Reveal(); clear != "t0k3n" {
+		t.Error("Reveal failed")
+		return
+	}
+}
+
+// Test_Secret_SaveLoad
+func Test_Secret_SaveLoad(t *testing.T) {
+
+	store := accountStore()
+
+	if _, e := tinystore.SaveJson(store); e != tinystore.ErrNoSecretKey {
+		t.Errorf("Should need a key: %v", e)
+		return
+	}
+
+	tinystore.SetSecretKey(testKey(1))
+	defer tinystore.SetSecretKey(nil)
+
+	bytes, e := tinystore.SaveJson(store)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if text := string(bytes); strings.Contains(text, "t0k3n") || strings.Contains(text, "P@55w0rd!") || !strings.Contains(text, `"me"`) {
+		t.Errorf("Should seal secrets only: %s", text)
+		return
+	}
+
+	store.Clear()
+	if e := tinystore.LoadJson(store, bytes); e != nil {
+		t.Error(e)
+		return
+	}
+	x, _ := tinystore.FindByKey(store, "me")
+	loaded := x.(*account)
+	if loaded.Password != "P@55w0rd!" {
+		t.Error("Tagged fields should be decrypted on load")
+		return
+	}
+	if !loaded.Token.Sealed() {
+		t.Error("Secret should stay sealed until Reveal")
+		return
+	}
+	if clear, e := loaded.Token.Reveal(); e != nil || clear != "t0k3n" {
+		t.Errorf("Reveal failed: %v", e)
+		return
+	}
+
+	again, _ := tinystore.SaveJson(store)
+	store.Clear()
+	tinystore.LoadJson(store, again)
+	x, _ = tinystore.FindByKey(store, "me")
+	if clear, _ := AsAccount(x).Token.Reveal(); clear != "t0k3n" || AsAccount(x).Password != "P@55w0rd!" {
+		t.Error("Should survive a second save")
+		return
+	}
+
+	tinystore.SetSecretKey(testKey(2))
+	if _, e := loaded.Token.Reveal(); !errors.Is(e, tinystore.ErrDecryptionFailed) {
+		t.Errorf("Wrong key should fail: %v", e)
+		return
+	}
+}
+
+// Test_Secret_Keyring secrets sealed by an old key open after rotation
+func Test_Secret_Keyring(t *testing.T) {
+
+	ring := tinystore.NewKeyring("v1", testKey(1))
+	tinystore.SetSecretKey(ring)
+	defer tinystore.SetSecretKey(nil)
+
+	store := accountStore()
+	bytes, _ := tinystore.SaveJson(store)
+	ring.Rotate("v2", testKey(2))
+
+	store.Clear()
+	if e := tinystore.LoadJson(store, bytes); e != nil {
+		t.Error(e)
+		return
+	}
+	x, _ := tinystore.FindByKey(store, "me")
+	if clear, e := AsAccount(x).Token.Reveal(); e != nil || clear != "t0k3n" {
+		t.Errorf("Should open with v1: %v", e)
+		return
+	}
+}
+
+// Test_Secret_Patch patches keep secrets
+func Test_Secret_Patch(t *testing.T) {
+
+	store := accountStore()
+	if e := store.Patch("me", map[string]interface{}{"password": "changed"}); e != nil {
+		t.Error(e)
+		return
+	}
+	x, _ := tinystore.FindByKey(store, "me")
+	if clear, _ := AsAccount(x).Token.Reveal(); clear != "t0k3n" || AsAccount(x).Password != "changed" {
+		t.Errorf("Patch lost a secret: %v", clear)
+		return
+	}
+}
+
+// Test_WithSecretFields adapters mark fields of items that can't be tagged
+func Test_WithSecretFields(t *testing.T) {
+
+	tinystore.SetSecretKey(testKey(1))
+	defer tinystore.SetSecretKey(nil)
+
+	store := &tinystore.SimpleStore{Name: "SecretCredentials"}
+	tinystore.RegisterStoreAdapter(store, tinystore.WithSecretFields(tinystore.NewDefaultStoreItemAdapter(convert), "Password"))
+	store.Add(&DumyyItem{"admin", "P@55w0rd!"})
+
+	bytes, e := tinystore.SaveJson(store)
+	if e != nil || strings.Contains(string(bytes), "P@55w0rd!") {
+		t.Errorf("Should seal Password: %s %v", bytes, e)
+		return
+	}
+	store.Clear()
+	if e := tinystore.LoadJson(store, bytes); e != nil {
+		t.Error(e)
+		return
+	}
+	x, _ := tinystore.FindByKey(store, "admin")
+	if AsCredential(x).Password != "P@55w0rd!" {
+		t.Error("Should open Password")
+		return
+	}
+	if doc, _ := tinystore.ToMapOf(store, x); doc["Password"] != "***" || doc["Username"] != "admin" {
+		t.Errorf("ToMapOf should mask Password: %v", doc)
+		return
+	}
+}
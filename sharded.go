@@ -0,0 +1,284 @@
+package tinystore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// ShardedStore implements Store for concurrent use,
+// keys are hashed into shards each with its own sync.RWMutex and key index,
+// readers and writers on different shards don't wait for each other.
+// Operations spanning every shard lock all of them, in order, so they see and leave a consistent store.
+// All order is by shard then insertion, removals may reorder a shard.
+// The zero value is ready to use with DefaultShards shards
+type ShardedStore struct {
+	shards []*shard
+	once   sync.Once
+
+	// Name instance name , nick name , identifier , etc...
+	Name string
+}
+
+type shard struct {
+	mutex sync.RWMutex
+	items []StoreItem
+	// index position of each key in items
+	index map[interface{}]int
+}
+
+// DefaultShards used by NewShardedStore when shards < 1
+const DefaultShards = 32
+
+// NewShardedStore returns an empty ShardedStore with n shards
+func NewShardedStore(name string, n int) *ShardedStore {
+	if n < 1 {
+		n = DefaultShards
+	}
+	return &ShardedStore{shards: newShards(n), Name: name}
+}
+
+func newShards(n int) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{index: make(map[interface{}]int)}
+	}
+	return shards
+}
+
+// ready returns the shards, creating DefaultShards of them for a zero value store
+func (store *ShardedStore) ready() []*shard {
+	store.once.Do(func() {
+		if len(store.shards) == 0 {
+			store.shards = newShards(DefaultShards)
+		}
+	})
+	return store.shards
+}
+
+// shardIndex hashes key into [0, n)
+func shardIndex(key interface{}, n int) int {
+	h := fnv.New32a()
+	switch k := key.(type) {
+	case string:
+		h.Write([]byte(k))
+	default:
+		fmt.Fprint(h, k)
+	}
+	return int(h.Sum32() % uint32(n))
+}
+
+func (store *ShardedStore) shardOf(key interface{}) *shard {
+	shards := store.ready()
+	return shards[shardIndex(key, len(shards))]
+}
+
+// lockAll write locks every shard in order
+func (store *ShardedStore) lockAll() {
+	for _, s := range store.ready() {
+		s.mutex.Lock()
+	}
+}
+
+func (store *ShardedStore) unlockAll() {
+	for _, s := range store.ready() {
+		s.mutex.Unlock()
+	}
+}
+
+// add appends item, caller holds the shard lock
+func (s *shard) add(item StoreItem) {
+	s.index[item.GetKey()] = len(s.items)
+	s.items = append(s.items, item)
+}
+
+// removeAt swaps the last item into i, caller holds the shard lock
+func (s *shard) removeAt(i int) {
+	delete(s.index, s.items[i].GetKey())
+	last := len(s.items) - 1
+	if i != last {
+		s.items[i] = s.items[last]
+		s.index[s.items[i].GetKey()] = i
+	}
+	s.items[last] = nil
+	s.items = s.items[:last]
+}
+
+// reset empties the shard, caller holds the shard lock
+func (s *shard) reset() {
+	s.items = nil
+	s.index = make(map[interface{}]int)
+}
+
+// GetName implements Store.GetName
+func (store *ShardedStore) GetName() string {
+	return store.Name
+}
+
+// All implements Store.All, returns a copy
+func (store *ShardedStore) All() []StoreItem {
+	for _, s := range store.ready() {
+		s.mutex.RLock()
+	}
+	defer func() {
+		for _, s := range store.ready() {
+			s.mutex.RUnlock()
+		}
+	}()
+	result := make([]StoreItem, 0)
+	for _, s := range store.ready() {
+		result = append(result, s.items...)
+	}
+	return result
+}
+
+// Get returns the item matching key, only locks its shard
+func (store *ShardedStore) Get(key interface{}) (StoreItem, error) {
+	s := store.shardOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if i, ok := s.index[key]; ok {
+		return s.items[i], nil
+	}
+	return nil, ErrNotFound
+}
+
+// Find implements Store.Find, read locks one shard at a time
+func (store *ShardedStore) Find(filter Filter) (StoreItem, error) {
+	for _, s := range store.ready() {
+		s.mutex.RLock()
+		for _, x := range s.items {
+			if filter(x) {
+				s.mutex.RUnlock()
+				return x, nil
+			}
+		}
+		s.mutex.RUnlock()
+	}
+	return nil, ErrNotFound
+}
+
+// Add implements Store.Add
+func (store *ShardedStore) Add(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	s := store.shardOf(item.GetKey())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.index[item.GetKey()]; exists {
+		return ErrAlreadyExists
+	}
+	s.add(item)
+	return nil
+}
+
+// Remove implements Store.Remove
+func (store *ShardedStore) Remove(item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	s := store.shardOf(item.GetKey())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i, exists := s.index[item.GetKey()]
+	if !exists {
+		return ErrNotFound
+	}
+	s.removeAt(i)
+	return nil
+}
+
+// Clear implements Store.Clear
+func (store *ShardedStore) Clear() {
+	store.lockAll()
+	defer store.unlockAll()
+	for _, s := range store.ready() {
+		s.reset()
+	}
+}
+
+// Load implements Store.Load, does not do error checking, a repeated key replaces the previous item
+func (store *ShardedStore) Load(items ...StoreItem) error {
+	store.lockAll()
+	defer store.unlockAll()
+	store.load(items)
+	return nil
+}
+
+// load distributes items into empty shards, caller holds every shard lock
+func (store *ShardedStore) load(items []StoreItem) {
+	for _, s := range store.ready() {
+		s.reset()
+	}
+	for _, item := range items {
+		s := store.shardOf(item.GetKey())
+		if i, exists := s.index[item.GetKey()]; exists {
+			s.items[i] = item
+			continue
+		}
+		s.add(item)
+	}
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (store *ShardedStore) RemoveWhere(filter Filter) error {
+	store.lockAll()
+	defer store.unlockAll()
+	var e error = ErrNotFound
+	for _, s := range store.ready() {
+		for i := len(s.items) - 1; i >= 0; i-- {
+			if filter(s.items[i]) {
+				s.removeAt(i)
+				e = nil
+			}
+		}
+	}
+	return e
+}
+
+// ForEach implements Store.ForEach, mutated items are re-hashed in case their key changed,
+// returns the first mutator error, failed items are kept unchanged
+func (store *ShardedStore) ForEach(f Mutator) error {
+	_, e := store.forEachWhere(Always, f)
+	return e
+}
+
+// ForEachWhere implements Store.ForEachWhere, mutates every matching item, SimpleStore stops at the first
+func (store *ShardedStore) ForEachWhere(filter Filter, transform Mutator) error {
+	found, e := store.forEachWhere(filter, transform)
+	if !found {
+		return ErrNotFound
+	}
+	return e
+}
+
+func (store *ShardedStore) forEachWhere(filter Filter, transform Mutator) (bool, error) {
+	store.lockAll()
+	defer store.unlockAll()
+
+	var err error
+	found := false
+	items := make([]StoreItem, 0)
+	for _, s := range store.ready() {
+		for _, x := range s.items {
+			if !filter(x) {
+				items = append(items, x)
+				continue
+			}
+			found = true
+			r, e := transform(x)
+			if e != nil {
+				if err == nil {
+					err = e
+				}
+				r = x
+			}
+			items = append(items, r)
+		}
+	}
+	if found {
+		store.load(items)
+	}
+	return found, err
+}
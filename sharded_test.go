@@ -0,0 +1,188 @@
+package tinystore_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_ShardedStore
+func Test_ShardedStore(t *testing.T) {
+
+	var store tinystore.Store = tinystore.NewShardedStore("Test_ShardedStore", 4)
+
+	for i := 0; i < 100; i++ {
+		if e := store.Add(&DumyyItem{fmt.Sprint(i), "1234"}); e != nil {
+			t.Error(e)
+			return
+		}
+	}
+	if e := store.Add(&DumyyItem{"1", "1234"}); e != tinystore.ErrAlreadyExists {
+		t.Error("Should exist")
+		return
+	}
+	if tinystore.Length(store) != 100 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+	if x, e := tinystore.FindByKey(store, "42"); e != nil || AsCredentialGetName(x) != "42" {
+		t.Error("Find failed")
+		return
+	}
+
+	if e := store.Remove(&DumyyItem{"42", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if _, e := store.(*tinystore.ShardedStore).Get("42"); e != tinystore.ErrNotFound {
+		t.Error("Should be removed")
+		return
+	}
+
+	// every key but 1x
+	if e := store.RemoveWhere(tinystore.NotFilter(func(item tinystore.StoreItem) bool {
+		name := AsCredentialGetName(item)
+		return len(name) == 2 && name[0] == '1'
+	})); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(store) != 10 {
+		t.Errorf("Bad Length: %v", tinystore.Length(store))
+		return
+	}
+
+	if e := store.ForEachWhere(NameFilter("10"), changePassword("abcd")); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := store.(*tinystore.ShardedStore).Get("10"); AsCredential(x).Password != "abcd" {
+		t.Error("ForEachWhere failed")
+	}
+	if e := store.ForEachWhere(NameFilter("nobody"), changePassword("abcd")); e != tinystore.ErrNotFound {
+		t.Error("Should be NotFound")
+	}
+
+	// mutators may change keys
+	if e := store.ForEach(func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"x" + AsCredentialGetName(item), "1234"}, nil
+	}); e != nil {
+		t.Error(e)
+		return
+	}
+	if _, e := store.(*tinystore.ShardedStore).Get("x10"); e != nil {
+		t.Error(e)
+		return
+	}
+
+	store.Load(&DumyyItem{"me", "1234"})
+	if tinystore.Length(store) != 1 {
+		t.Error("Load failed")
+	}
+	store.Clear()
+	if tinystore.Length(store) != 0 {
+		t.Error("Clear failed")
+	}
+}
+
+// Test_ShardedStore_Concurrent run with -race
+func Test_ShardedStore_Concurrent(t *testing.T) {
+
+	store := tinystore.NewShardedStore("", 8)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				name := fmt.Sprintf("%v-%v", w, i)
+				store.Add(&DumyyItem{name, "1234"})
+				store.Get(name)
+				tinystore.Length(store)
+				if i%10 == 0 {
+					store.ForEachWhere(NameFilter(name), changePassword("abcd"))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if tinystore.Length(store) != 800 {
+		t.Errorf("Bad Length %v", tinystore.Length(store))
+	}
+}
+
+// benchmarkStore runs b.N mixed operations, 80% lookups by key with find and 20% add/remove, split across goroutines
+func benchmarkStore(b *testing.B, store tinystore.Store, goroutines int, find func(key interface{})) {
+	const size = 1000
+	for i := 0; i < size; i++ {
+		store.Add(&DumyyItem{fmt.Sprint(i), "1234"})
+	}
+	b.ResetTimer()
+
+	wg := sync.WaitGroup{}
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(int64(g)))
+			for i := g; i < b.N; i += goroutines {
+				if i%5 == 0 {
+					name := fmt.Sprintf("g%v-%v", g, i)
+					store.Add(&DumyyItem{name, "1234"})
+					store.Remove(&DumyyItem{name, "1234"})
+					continue
+				}
+				find(fmt.Sprint(random.Intn(size)))
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// Benchmark_Stores compares locking, both stores find by key with the same linear FindByKey
+func Benchmark_Stores(b *testing.B) {
+	for _, goroutines := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("SimpleStore/%v", goroutines), func(b *testing.B) {
+			store := &tinystore.SimpleStore{}
+			benchmarkStore(b, store, goroutines, func(key interface{}) {
+				tinystore.FindByKey(store, key)
+			})
+		})
+		b.Run(fmt.Sprintf("ShardedStore/%v", goroutines), func(b *testing.B) {
+			store := tinystore.NewShardedStore("", 0)
+			benchmarkStore(b, store, goroutines, func(key interface{}) {
+				tinystore.FindByKey(store, key)
+			})
+		})
+	}
+}
+
+// Benchmark_ShardedStore_Get the same mix using the hashed ShardedStore.Get lookup
+func Benchmark_ShardedStore_Get(b *testing.B) {
+	for _, goroutines := range []int{1, 8, 64} {
+		b.Run(fmt.Sprint(goroutines), func(b *testing.B) {
+			store := tinystore.NewShardedStore("", 0)
+			benchmarkStore(b, store, goroutines, func(key interface{}) {
+				store.Get(key)
+			})
+		})
+	}
+}
+
+// Test_ShardedStore_ZeroValue
+func Test_ShardedStore_ZeroValue(t *testing.T) {
+
+	store := &tinystore.ShardedStore{Name: "Zero"}
+	if e := store.Add(&DumyyItem{"me", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, e := store.Get("me"); e != nil || AsCredentialGetName(x) != "me" || tinystore.Length(store) != 1 {
+		t.Error("Zero value should work")
+		return
+	}
+}
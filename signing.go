@@ -0,0 +1,203 @@
+package tinystore
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// bundleContext prefixes every signed message, so signatures can't be replayed elsewhere
+	bundleContext = "tinystore-bundle-v1"
+	// bundleFormat payload format, SaveJson output
+	bundleFormat = "json"
+	// unsigned algorithm of unsigned bundles
+	unsigned = "none"
+)
+
+// Signer signs export bundles
+type Signer interface {
+	Algorithm() string
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier checks export bundle signatures
+type Verifier interface {
+	Algorithm() string
+	// Verify returns nil if signature is valid for message
+	Verify(message []byte, signature []byte) error
+}
+
+// HMACKey signs and verifies with HMAC-SHA256
+type HMACKey []byte
+
+func (k HMACKey) Algorithm() string {
+	return "HMAC-SHA256"
+}
+
+func (k HMACKey) Sign(message []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(message []byte, signature []byte) error {
+	expected, _ := k.Sign(message)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Ed25519Signer signs with an Ed25519 private key
+type Ed25519Signer ed25519.PrivateKey
+
+func (k Ed25519Signer) Algorithm() string {
+	return "Ed25519"
+}
+
+func (k Ed25519Signer) Sign(message []byte) ([]byte, error) {
+	if len(k) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("tinystore: invalid Ed25519 private key length %d", len(k))
+	}
+	return ed25519.Sign(ed25519.PrivateKey(k), message), nil
+}
+
+// Ed25519Verifier verifies with an Ed25519 public key
+type Ed25519Verifier ed25519.PublicKey
+
+func (k Ed25519Verifier) Algorithm() string {
+	return "Ed25519"
+}
+
+func (k Ed25519Verifier) Verify(message []byte, signature []byte) error {
+	if len(k) != ed25519.PublicKeySize || !ed25519.Verify(ed25519.PublicKey(k), message, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// BundleMeta describes an export bundle, it is signed with the payload
+type BundleMeta struct {
+	Store     string    `json:"store"`
+	Count     int       `json:"count"`
+	Time      time.Time `json:"time"`
+	Format    string    `json:"format"`
+	Algorithm string    `json:"algorithm"`
+}
+
+// bundle meta is kept raw, its exact bytes are signed
+type bundle struct {
+	Meta      json.RawMessage `json:"meta"`
+	Payload   []byte          `json:"payload"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+// signedMessage what bundle signatures cover
+func signedMessage(meta []byte, payload []byte) []byte {
+	message := make([]byte, 0, len(bundleContext)+len(meta)+len(payload)+2)
+	message = append(message, bundleContext...)
+	message = append(message, 0)
+	message = append(message, meta...)
+	message = append(message, 0)
+	return append(message, payload...)
+}
+
+// ExportSigned returns the store items, saved by SaveJson, in a bundle signed by signer,
+// nil signer makes an unsigned bundle
+func ExportSigned(store Store, signer Signer) ([]byte, error) {
+	// count and payload from the same view
+	items := store.All()
+	payload, e := saveJson(adapterName(store), items)
+	if e != nil {
+		return nil, e
+	}
+	meta := BundleMeta{Store: store.GetName(), Count: len(items), Time: time.Now().UTC(), Format: bundleFormat, Algorithm: unsigned}
+	if signer != nil {
+		meta.Algorithm = signer.Algorithm()
+	}
+	raw, e := json.Marshal(meta)
+	if e != nil {
+		return nil, e
+	}
+	result := bundle{Meta: raw, Payload: payload}
+	if signer != nil {
+		if result.Signature, e = signer.Sign(signedMessage(raw, payload)); e != nil {
+			return nil, e
+		}
+	}
+	// not indented, that would reformat the signed meta
+	return json.Marshal(result)
+}
+
+// ExportSignedFile writes ExportSigned to path, replacing it atomically
+func ExportSignedFile(store Store, path string, signer Signer) error {
+	data, e := ExportSigned(store, signer)
+	if e != nil {
+		return e
+	}
+	return writeFile(path, data)
+}
+
+// ImportOptions relax ImportSigned checks, the zero value is strict
+type ImportOptions struct {
+	// AllowUnsigned accepts unsigned bundles
+	AllowUnsigned bool
+	// SkipVerify accepts bundles whatever their signature, for recovery only
+	SkipVerify bool
+}
+
+// ImportSigned verifies a bundle made by ExportSigned with verifier and loads it like LoadJson,
+// ErrUnsigned and ErrInvalidSignature refuse it unless options allow. Nothing is loaded on error
+func ImportSigned(store Store, data []byte, verifier Verifier, options ImportOptions) (BundleMeta, error) {
+	var meta BundleMeta
+	var signed bundle
+	if e := json.Unmarshal(data, &signed); e != nil || len(signed.Meta) == 0 {
+		return meta, ErrInvalidSignature.Wrap(fmt.Errorf("not a bundle"))
+	}
+	if e := json.Unmarshal(signed.Meta, &meta); e != nil {
+		return meta, ErrInvalidSignature.Wrap(e)
+	}
+	if meta.Format != bundleFormat {
+		return meta, ErrInvalidSignature.Wrap(fmt.Errorf("unsupported format %q", meta.Format))
+	}
+	if e := verifyBundle(signed, meta, verifier, options); e != nil {
+		return meta, e
+	}
+	if docs, _, e := parseDocuments(signed.Payload); e != nil || len(docs) != meta.Count {
+		return meta, ErrIntegrity.Wrap(fmt.Errorf("bundle should have %d items", meta.Count))
+	}
+	return meta, LoadJson(store, signed.Payload)
+}
+
+// ImportSignedFile reads path and imports it like ImportSigned
+func ImportSignedFile(store Store, path string, verifier Verifier, options ImportOptions) (BundleMeta, error) {
+	data, e := ioutil.ReadFile(path)
+	if e != nil {
+		return BundleMeta{}, e
+	}
+	return ImportSigned(store, data, verifier, options)
+}
+
+func verifyBundle(signed bundle, meta BundleMeta, verifier Verifier, options ImportOptions) error {
+	if options.SkipVerify {
+		return nil
+	}
+	if meta.Algorithm == unsigned || len(signed.Signature) == 0 {
+		if options.AllowUnsigned {
+			return nil
+		}
+		return ErrUnsigned
+	}
+	if verifier == nil {
+		return ErrInvalidSignature.Wrap(fmt.Errorf("no verifier for %s", meta.Algorithm))
+	}
+	if verifier.Algorithm() != meta.Algorithm {
+		return ErrInvalidSignature.Wrap(fmt.Errorf("bundle is signed with %s, verifier uses %s", meta.Algorithm, verifier.Algorithm()))
+	}
+	return verifier.Verify(signedMessage(signed.Meta, signed.Payload), signed.Signature)
+}
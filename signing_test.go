@@ -0,0 +1,151 @@
+package tinystore_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_ExportSigned_HMAC
+func Test_ExportSigned_HMAC(t *testing.T) {
+
+	store := credentialStore(t)
+	key := tinystore.HMACKey("shared secret")
+
+	data, e := tinystore.ExportSigned(store, key)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+
+	store.Clear()
+	meta, e := tinystore.ImportSigned(store, data, key, tinystore.ImportOptions{})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if meta.Store != "SimpleStore" || meta.Count != 2 || meta.Algorithm != "HMAC-SHA256" || meta.Time.IsZero() {
+		t.Errorf("Bad meta: %+v", meta)
+		return
+	}
+	if tinystore.Length(store) != 2 {
+		t.Error("Should import")
+		return
+	}
+
+	store.Clear()
+	if _, e := tinystore.ImportSigned(store, data, tinystore.HMACKey("other"), tinystore.ImportOptions{}); !errors.Is(e, tinystore.ErrInvalidSignature) {
+		t.Errorf("Wrong key should fail: %v", e)
+		return
+	}
+	tampered := bytes.Replace(data, []byte(`"count":2`), []byte(`"count":3`), 1)
+	if _, e := tinystore.ImportSigned(store, tampered, key, tinystore.ImportOptions{}); !errors.Is(e, tinystore.ErrInvalidSignature) {
+		t.Errorf("Tampered meta should fail: %v", e)
+		return
+	}
+	if tinystore.Length(store) != 0 {
+		t.Error("Nothing should be imported")
+		return
+	}
+	if _, e := tinystore.ImportSigned(store, tampered, key, tinystore.ImportOptions{SkipVerify: true}); !errors.Is(e, tinystore.ErrIntegrity) {
+		t.Errorf("Count should still be checked: %v", e)
+		return
+	}
+}
+
+// Test_ExportSigned_Ed25519
+func Test_ExportSigned_Ed25519(t *testing.T) {
+
+	public, private, _ := ed25519.GenerateKey(nil)
+	store := credentialStore(t)
+	path := filepath.Join(t.TempDir(), "bundle.json")
+
+	if e := tinystore.ExportSignedFile(store, path, tinystore.Ed25519Signer(private)); e != nil {
+		t.Error(e)
+		return
+	}
+	store.Clear()
+	if _, e := tinystore.ImportSignedFile(store, path, tinystore.Ed25519Verifier(public), tinystore.ImportOptions{}); e != nil {
+		t.Error(e)
+		return
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, e := tinystore.ImportSignedFile(store, path, tinystore.Ed25519Verifier(other), tinystore.ImportOptions{}); !errors.Is(e, tinystore.ErrInvalidSignature) {
+		t.Errorf("Other key should fail: %v", e)
+		return
+	}
+	if _, e := tinystore.ImportSignedFile(store, path, tinystore.HMACKey("x"), tinystore.ImportOptions{}); !errors.Is(e, tinystore.ErrInvalidSignature) {
+		t.Errorf("Other algorithm should fail: %v", e)
+		return
+	}
+}
+
+// Test_ExportSigned_Unsigned
+func Test_ExportSigned_Unsigned(t *testing.T) {
+
+	store := credentialStore(t)
+	data, _ := tinystore.ExportSigned(store, nil)
+
+	if _, e := tinystore.ImportSigned(store, data, tinystore.HMACKey("x"), tinystore.ImportOptions{}); e != tinystore.ErrUnsigned {
+		t.Errorf("Unsigned should be refused: %v", e)
+		return
+	}
+	if _, e := tinystore.ImportSigned(store, data, nil, tinystore.ImportOptions{AllowUnsigned: true}); e != nil {
+		t.Error(e)
+		return
+	}
+
+	// signature stripped from a signed bundle
+	signed, _ := tinystore.ExportSigned(store, tinystore.HMACKey("x"))
+	doc := make(map[string]interface{})
+	json.Unmarshal(signed, &doc)
+	delete(doc, "signature")
+	stripped, _ := json.Marshal(doc)
+	if _, e := tinystore.ImportSigned(store, stripped, tinystore.HMACKey("x"), tinystore.ImportOptions{}); e != tinystore.ErrUnsigned {
+		t.Errorf("Stripped signature should be refused: %v", e)
+		return
+	}
+
+	if _, e := tinystore.ImportSigned(store, []byte(`[]`), nil, tinystore.ImportOptions{AllowUnsigned: true}); !errors.Is(e, tinystore.ErrInvalidSignature) {
+		t.Errorf("Should not be a bundle: %v", e)
+		return
+	}
+}
+
+// growingStore gets a new item after every All, as if written concurrently
+type growingStore struct {
+	*tinystore.SimpleStore
+	added int
+}
+
+func (s *growingStore) All() []tinystore.StoreItem {
+	items := s.SimpleStore.All()
+	s.added++
+	s.SimpleStore.Add(&DumyyItem{fmt.Sprint("late", s.added), "1234"})
+	return items
+}
+
+// Test_ExportSigned_Snapshot
+func Test_ExportSigned_Snapshot(t *testing.T) {
+
+	store := &growingStore{SimpleStore: &tinystore.SimpleStore{Name: "SimpleStore"}}
+	store.SimpleStore.Add(&DumyyItem{"me", "1234"})
+	key := tinystore.HMACKey("shared secret")
+
+	data, e := tinystore.ExportSigned(store, key)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	meta, e := tinystore.ImportSigned(&tinystore.SimpleStore{Name: "SimpleStore"}, data, key, tinystore.ImportOptions{})
+	if e != nil || meta.Count != 1 {
+		t.Errorf("Count and payload should match: %v, %+v", e, meta)
+		return
+	}
+}
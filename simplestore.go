@@ -1,27 +1,54 @@
 package tinystore
 
 import (
-	"sync"
+	"context"
+	"sync/atomic"
 	"errors"
 )
 
-// SimpleStore implements  Store
+// SimpleStore implements  Store,
+// writers copy the items and publish the new slice, readers never wait for the lock
 type SimpleStore struct {
-	mutex   sync.Mutex
+	mutex   contextMutex
 
-	items   []StoreItem
+	// items immutable once published, see load and publish
+	items   atomic.Pointer[[]StoreItem]
+
+	// revision store wide, increased by every mutation
+	revision uint64
+	// versions revision at which each key last changed
+	versions map[interface{}]uint64
+	// history nil unless EnableHistory was called
+	history *history
+
+	// Clock time source for history, nil means time.Now
+	Clock Clock
 
 	// Name instance name , nick name , identifier , etc...
 	Name string
 }
 
+// GetName implements Store.GetName
 func (store SimpleStore) GetName() string {
 	return store.Name
 }
 
-// All implements Store.All
+// load returns the published items, they must not be modified
+func (store *SimpleStore) load() []StoreItem {
+	if items := store.items.Load(); items != nil {
+		return *items
+	}
+	return nil
+}
+
+// publish replaces the items, caller holds the lock and must not modify items afterwards
+func (store *SimpleStore) publish(items []StoreItem) {
+	store.items.Store(&items)
+}
+
+// All implements Store.All, returns a stable view that must not be modified
 func (s *SimpleStore) All() []StoreItem {
-	return s.items
+	return s.load()
 }
 
 // Length implements Store.Length
@@ -30,12 +57,28 @@ func(store *SimpleStore) Length() (int, error ) {
 		return 0 , errors.New("Nil Items")
 
 	}
-	return len(store.items), nil
+	return len(store.load()), nil
+}
+
+// AllContext implements ContextStore.AllContext
+func (s *SimpleStore) AllContext(ctx context.Context) ([]StoreItem, error) {
+	if e := contextError(ctx); e != nil {
+		return nil, e
+	}
+	return s.load(), nil
 }
 
 // Find implements Store.Find
 func (s *SimpleStore) Find(f Filter) (StoreItem, error) {
-	for _, x := range s.items {
+	return s.FindContext(context.Background(), f)
+}
+
+// FindContext implements ContextStore.FindContext
+func (s *SimpleStore) FindContext(ctx context.Context, f Filter) (StoreItem, error) {
+	for _, x := range s.load() {
+		if e := contextError(ctx); e != nil {
+			return nil, e
+		}
 		if f(x) {
 			return x, nil
 		}
@@ -45,17 +88,34 @@ func (s *SimpleStore) Find(f Filter) (StoreItem, error) {
 
 // Clear Implements Store.Clear
 func (s *SimpleStore) Clear() {
-	s.mutex.Lock()
+	s.ClearContext(context.Background())
+}
+
+// ClearContext implements ContextStore.ClearContext
+func (s *SimpleStore) ClearContext(ctx context.Context) error {
+	if e := s.mutex.LockContext(ctx); e != nil {
+		return e
+	}
 	defer s.mutex.Unlock()
-	s.items = make([]StoreItem, 0)
+	s.bump()
+	s.forgetAll()
+	s.publish(make([]StoreItem, 0))
+	return nil
 }
 
 // Remove implements Store.Remove
 func (store *SimpleStore) Remove(item StoreItem) error {
+	return store.RemoveContext(context.Background(), item)
+}
+
+// RemoveContext implements ContextStore.RemoveContext
+func (store *SimpleStore) RemoveContext(ctx context.Context, item StoreItem) error {
 
 	if ex:= item.Validate() ; ex!= nil { return ex }
 
-	store.mutex.Lock()
+	if ex := store.mutex.LockContext(ctx); ex != nil {
+		return ex
+	}
 
 	defer store.mutex.Unlock()
 
@@ -63,7 +123,7 @@ func (store *SimpleStore) Remove(item StoreItem) error {
 
 	var e error = ErrNotFound
 
-	for _, current := range store.items {
+	for _, current := range store.load() {
 		if  AreKeysEqual(current, item){
 			e = nil
 			continue
@@ -73,7 +133,9 @@ func (store *SimpleStore) Remove(item StoreItem) error {
 	}
 
 	if e == nil {
-		store.items = result
+		store.bump()
+		store.forget(item.GetKey())
+		store.publish(result)
 	}
 
 	return e
@@ -86,43 +148,64 @@ func AreKeysEqual(a StoreItem, b StoreItem) bool {
 }
 // Add always...
 func (store *SimpleStore) Add(item StoreItem) error {
+	return store.AddContext(context.Background(), item)
+}
+
+// AddContext implements ContextStore.AddContext
+func (store *SimpleStore) AddContext(ctx context.Context, item StoreItem) error {
 
 	if ex:= item.Validate(); ex != nil {
 		return ex
 	}
 
-	found := Exists(store, func(x StoreItem) bool {
-		return x.GetKey() == item.GetKey()
-	})
+	if ex := store.mutex.LockContext(ctx); ex != nil {
+		return ex
+	}
+	defer store.mutex.Unlock()
 
-	if !found {
-		store.mutex.Lock()
-		store.items = append(store.items, item)
-		store.mutex.Unlock()
-		return nil
+	if store.indexOf(item.GetKey()) >= 0 {
+		return ErrAlreadyExists
 	}
 
-	return ErrAlreadyExists
+	store.append(item)
+	return nil
 }
 
 // RemoveWhere should go , .. should be <tinystore>.RemoveWhere(store, filter ) error
 func (s *SimpleStore) RemoveWhere(find Filter) error  {
+	return s.RemoveWhereContext(context.Background(), find)
+}
+
+// RemoveWhereContext implements ContextStore.RemoveWhereContext,
+// nothing is removed if ctx is done before every item was checked
+func (s *SimpleStore) RemoveWhereContext(ctx context.Context, find Filter) error {
 
 	result := make([]StoreItem, 0)
+	removed := make([]interface{}, 0)
 	var e error = ErrNotFound
 
-	s.mutex.Lock()
+	if ex := s.mutex.LockContext(ctx); ex != nil {
+		return ex
+	}
 	defer s.mutex.Unlock()
 
-	for _, x := range s.items[:] {
+	for _, x := range s.load() {
+		if ex := contextError(ctx); ex != nil {
+			return ex
+		}
 		if find(x) { // Skip
 			e = nil
+			removed = append(removed, x.GetKey())
 			continue
 		}
 		result = append(result, x)
 	}
 	if e ==nil {
-		s.items = result
+		s.bump()
+		for _, key := range removed {
+			s.forget(key)
+		}
+		s.publish(result)
 	}
 
 	return e
@@ -130,27 +213,58 @@ func (s *SimpleStore) RemoveWhere(find Filter) error  {
 
 // ForEach implements Store.ForEach
 func (s *SimpleStore) ForEach(f Mutator) error {
-	s.mutex.Lock()
+	return s.ForEachContext(context.Background(), f)
+}
+
+// ForEachContext implements ContextStore.ForEachContext,
+// nothing is published if ctx is done before every item was mutated
+func (s *SimpleStore) ForEachContext(ctx context.Context, f Mutator) error {
+	if ex := s.mutex.LockContext(ctx); ex != nil {
+		return ex
+	}
 	defer s.mutex.Unlock()
 	var e error = nil
-	for i, x := range s.items {
+	items := append([]StoreItem(nil), s.load()...)
+	mutated := make([]StoreItem, 0, len(items))
+	for i, x := range items {
+		if ex := contextError(ctx); ex != nil {
+			return ex
+		}
 		r, e := f(x)
 		if e == nil {
-			s.items[i] = r
+			items[i] = r
+			mutated = append(mutated, r)
 		}
 	}
+	s.bump()
+	for _, r := range mutated {
+		s.touch(r)
+	}
+	s.publish(items)
 	return e
 }
 
 // ForEachWhere implements Store.ForEachWhere
 func (s *SimpleStore) ForEachWhere(find Filter, transform Mutator) error {
-	s.mutex.Lock()
+	return s.ForEachWhereContext(context.Background(), find, transform)
+}
+
+// ForEachWhereContext implements ContextStore.ForEachWhereContext
+func (s *SimpleStore) ForEachWhereContext(ctx context.Context, find Filter, transform Mutator) error {
+	if ex := s.mutex.LockContext(ctx); ex != nil {
+		return ex
+	}
 	defer s.mutex.Unlock()
 	var err error = ErrNotFound
-	for i, x := range s.items {
+	for i, x := range s.load() {
+		if ex := contextError(ctx); ex != nil {
+			return ex
+		}
 		if find(x) {
 			if r, e := transform(x) ;e == nil {
-				s.items[i] = r
+				s.publish(replaced(s.load(), i, r))
+				s.bump()
+				s.touch(r)
 				return e
 			}
 		}
@@ -171,7 +285,134 @@ func (s *SimpleStore) ForEachWhere(find Filter, transform Mutator) error {
 
 // Load implements Sore.Load, does not do error  checking
 func (store *SimpleStore) Load(c ...StoreItem) error {
-	store.items = c
+	return store.LoadContext(context.Background(), c...)
+}
+
+// LoadContext implements ContextStore.LoadContext
+func (store *SimpleStore) LoadContext(ctx context.Context, c ...StoreItem) error {
+	if e := store.mutex.LockContext(ctx); e != nil {
+		return e
+	}
+	defer store.mutex.Unlock()
+	store.reload(c)
 	// satisfy Interface
 	return nil
-}
\ No newline at end of file
+}
+
+// reload replaces every item with c, caller holds the lock
+func (store *SimpleStore) reload(c []StoreItem) {
+	store.bump()
+	store.forgetAll()
+	store.publish(append([]StoreItem(nil), c...))
+	for _, item := range c {
+		store.touch(item)
+	}
+}
+
+// append publishes items plus item, caller holds the lock
+func (store *SimpleStore) append(item StoreItem) {
+	items := store.load()
+	// full slice expression, always copy
+	store.publish(append(items[:len(items):len(items)], item))
+	store.bump()
+	store.touch(item)
+}
+
+// replaced returns a copy of items with items[i] = item
+func replaced(items []StoreItem, i int, item StoreItem) []StoreItem {
+	result := append([]StoreItem(nil), items...)
+	result[i] = item
+	return result
+}
+
+// indexOf returns the position of the item matching key or -1, caller holds the lock
+func (store *SimpleStore) indexOf(key interface{}) int {
+	for i, x := range store.load() {
+		if x.GetKey() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceAt validates item and replaces items[i], keys must match, caller holds the lock
+func (store *SimpleStore) replaceAt(i int, item StoreItem) error {
+	if item == nil {
+		return ErrInvalidStoreItem
+	}
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	if !AreKeysEqual(store.load()[i], item) {
+		return ErrInvalidStoreItem
+	}
+	store.publish(replaced(store.load(), i, item))
+	store.bump()
+	store.touch(item)
+	return nil
+}
+
+// Upsert implements Updater.Upsert
+func (store *SimpleStore) Upsert(item StoreItem) error {
+
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if i := store.indexOf(item.GetKey()); i >= 0 {
+		return store.replaceAt(i, item)
+	}
+	store.append(item)
+	return nil
+}
+
+// Replace implements Updater.Replace
+func (store *SimpleStore) Replace(item StoreItem) error {
+
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	i := store.indexOf(item.GetKey())
+	if i < 0 {
+		return ErrNotFound
+	}
+	return store.replaceAt(i, item)
+}
+
+// UpdateByKey implements Updater.UpdateByKey,
+// the mutated item is validated and must keep its key
+func (store *SimpleStore) UpdateByKey(key interface{}, mutator Mutator) error {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	i := store.indexOf(key)
+	if i < 0 {
+		return ErrNotFound
+	}
+	result, e := mutator(store.load()[i])
+	if e != nil {
+		return e
+	}
+	return store.replaceAt(i, result)
+}
+
+// Patch implements Updater.Patch, requires a StoreItemAdapter registered for store.Name
+func (store *SimpleStore) Patch(key interface{}, patch map[string]interface{}) error {
+
+	adapter, exists := LookupAdapter(store.GetName())
+	if !exists {
+		return ErrNotFound
+	}
+
+	return store.UpdateByKey(key, func(item StoreItem) (StoreItem, error) {
+		return PatchItem(adapter, item, patch)
+	})
+}
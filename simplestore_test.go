@@ -418,3 +418,98 @@ func Test_RemoveWhere(t *testing.T) {
 
 }
 
+
+func Test_Upsert(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+
+	if e := store.Upsert(&DumyyItem{"me", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := store.Upsert(&DumyyItem{"me", "4321"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(store) != 1 || AsCredential(store.All()[0]).Password != "4321" {
+		t.Error("Upsert Failed")
+	}
+	if e := store.Upsert(&DumyyItem{"me", ""}); e != tinystore.ErrInvalidStoreItem {
+		t.Error("Should be invalid")
+	}
+}
+
+func Test_Replace(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+
+	if e := store.Replace(&DumyyItem{"me", "1234"}); e != tinystore.ErrNotFound {
+		t.Error("Should be NotFound")
+		return
+	}
+	store.Add(&DumyyItem{"me", "1234"})
+	if e := store.Replace(&DumyyItem{"me", "abcd"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, e := tinystore.FindByKey(store, "me"); e != nil || AsCredential(x).Password != "abcd" {
+		t.Error("Replace Failed")
+	}
+}
+
+func Test_UpdateByKey(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.Add(&DumyyItem{"me", "1234"})
+
+	if e := store.UpdateByKey("you", reversePassword); e != tinystore.ErrNotFound {
+		t.Error("Should be NotFound")
+		return
+	}
+	if e := store.UpdateByKey("me", func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"me", "4321"}, nil
+	}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "4321" {
+		t.Error("UpdateByKey Failed")
+	}
+	// key can't change
+	if e := store.UpdateByKey("me", func(item tinystore.StoreItem) (tinystore.StoreItem, error) {
+		return &DumyyItem{"you", "4321"}, nil
+	}); e != tinystore.ErrInvalidStoreItem {
+		t.Error("Should be invalid")
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); x == nil {
+		t.Error("Item lost")
+	}
+}
+
+func Test_Patch(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "Test_Patch"}
+
+	if e := store.Patch("me", map[string]interface{}{"Password": "x"}); e != tinystore.ErrNotFound {
+		t.Error("Should fail without adapter")
+		return
+	}
+
+	tinystore.RegisterStoreAdapter(store, tinystore.NewDefaultStoreItemAdapter(convert))
+	store.Add(&DumyyItem{"me", "1234"})
+
+	if e := store.Patch("me", map[string]interface{}{"Password": "abcd"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "abcd" {
+		t.Error("Patch Failed")
+	}
+	// removing the password makes the item invalid
+	if e := store.Patch("me", map[string]interface{}{"Password": nil}); e != tinystore.ErrInvalidStoreItem {
+		t.Error("Should be invalid")
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "abcd" {
+		t.Error("Invalid patch applied")
+	}
+}
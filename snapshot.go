@@ -0,0 +1,81 @@
+package tinystore
+
+// Snapshotter is implemented by stores able to freeze their content
+type Snapshotter interface {
+	// Snapshot returns a read only Store with the items at the time of the call
+	Snapshot() Store
+}
+
+// SnapshotStore read only Store frozen at a point in time,
+// mutators return ErrReadOnly
+type SnapshotStore struct {
+	items    []StoreItem
+	revision uint64
+	name     string
+}
+
+// Snapshot implements Snapshotter.Snapshot
+func (store *SimpleStore) Snapshot() Store {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return &SnapshotStore{items: store.load(), revision: store.revision, name: store.Name}
+}
+
+// Revision of the store when the snapshot was taken
+func (store *SnapshotStore) Revision() uint64 {
+	return store.revision
+}
+
+// GetName implements Store.GetName
+func (store *SnapshotStore) GetName() string {
+	return store.name
+}
+
+// All implements Store.All
+func (store *SnapshotStore) All() []StoreItem {
+	return store.items
+}
+
+// Find implements Store.Find
+func (store *SnapshotStore) Find(filter Filter) (StoreItem, error) {
+	for _, x := range store.items {
+		if filter(x) {
+			return x, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Load implements Store.Load
+func (store *SnapshotStore) Load(items ...StoreItem) error {
+	return ErrReadOnly
+}
+
+// Add implements Store.Add
+func (store *SnapshotStore) Add(item StoreItem) error {
+	return ErrReadOnly
+}
+
+// Remove implements Store.Remove
+func (store *SnapshotStore) Remove(item StoreItem) error {
+	return ErrReadOnly
+}
+
+// Clear implements Store.Clear, does nothing
+func (store *SnapshotStore) Clear() {
+}
+
+// ForEach implements Store.ForEach
+func (store *SnapshotStore) ForEach(f Mutator) error {
+	return ErrReadOnly
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (store *SnapshotStore) RemoveWhere(f Filter) error {
+	return ErrReadOnly
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (store *SnapshotStore) ForEachWhere(f Filter, transform Mutator) error {
+	return ErrReadOnly
+}
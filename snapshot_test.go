@@ -0,0 +1,81 @@
+package tinystore_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Snapshot
+func Test_Snapshot(t *testing.T) {
+
+	store := &tinystore.SimpleStore{Name: "Test_Snapshot"}
+	store.Add(&DumyyItem{"me", "1234"})
+
+	snapshot := store.Snapshot()
+	store.Add(&DumyyItem{"you", "1234"})
+	store.Replace(&DumyyItem{"me", "4321"})
+
+	if tinystore.Length(snapshot) != 1 || tinystore.Length(store) != 2 {
+		t.Error("Snapshot changed")
+		return
+	}
+	if x, e := tinystore.FindByKey(snapshot, "me"); e != nil || AsCredential(x).Password != "1234" {
+		t.Error("Snapshot changed")
+	}
+	if snapshot.GetName() != store.GetName() {
+		t.Error("Bad name")
+	}
+	if e := snapshot.Add(&DumyyItem{"el", "1234"}); e != tinystore.ErrReadOnly {
+		t.Error("Should be read only")
+	}
+	snapshot.Clear()
+	if tinystore.Length(snapshot) != 1 {
+		t.Error("Snapshot cleared")
+	}
+}
+
+// Test_All_Stable
+func Test_All_Stable(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	store.Add(&DumyyItem{"me", "1234"})
+
+	all := store.All()
+	store.Upsert(&DumyyItem{"me", "4321"})
+	store.Add(&DumyyItem{"you", "1234"})
+
+	if len(all) != 1 || AsCredential(all[0]).Password != "1234" {
+		t.Error("All view changed")
+	}
+}
+
+// Test_Concurrent_Reads run with -race
+func Test_Concurrent_Reads(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				name := fmt.Sprintf("%v-%v", w, i)
+				store.Add(&DumyyItem{name, "1234"})
+				tinystore.Where(store, NameFilter(name))
+				tinystore.Exists(store, NameFilter(name))
+				tinystore.Length(store)
+				if i%2 == 0 {
+					store.Remove(&DumyyItem{name, "1234"})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if tinystore.Length(store) != 200 {
+		t.Errorf("Bad Length %v", tinystore.Length(store))
+	}
+}
@@ -0,0 +1,368 @@
+package tinystore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tombstone a soft deleted item
+type Tombstone struct {
+	Item      StoreItem
+	DeletedAt time.Time
+	// DeletedBy actor of the context it was removed with, see WithActor
+	DeletedBy string
+}
+
+// SoftDeleter is implemented by stores keeping removed items until purged
+type SoftDeleter interface {
+	// Deleted returns the tombstones, oldest first
+	Deleted() []Tombstone
+	// Restore brings back the deleted item matching key
+	Restore(key interface{}) error
+	// Purge removes tombstones older than olderThan for good, returns how many
+	Purge(olderThan time.Duration) int
+}
+
+// Deleted returns store tombstones, oldest first, nil if store is not a SoftDeleter
+func Deleted(store Store) []Tombstone {
+	if deleter, ok := store.(SoftDeleter); ok {
+		return deleter.Deleted()
+	}
+	return nil
+}
+
+// DeletionMark records that the item with Key, in its fmt.Sprint form, is soft deleted
+type DeletionMark struct {
+	Key       string    `json:"key"`
+	DeletedAt time.Time `json:"deletedAt"`
+	DeletedBy string    `json:"deletedBy,omitempty"`
+}
+
+// Valid implements StoreItem.Valid
+func (mark *DeletionMark) Valid() bool {
+	return mark != nil && mark.Key != ""
+}
+
+// Validate implements StoreItem.Validate
+func (mark *DeletionMark) Validate() error {
+	if mark.Valid() {
+		return nil
+	}
+	return ErrInvalidStoreItem
+}
+
+// GetKey implements StoreItem.GetKey
+func (mark *DeletionMark) GetKey() interface{} {
+	return mark.Key
+}
+
+// NewDeletionMarkAdapter returns a StoreItemAdapter converting documents to *DeletionMark
+func NewDeletionMarkAdapter() StoreItemAdapter {
+	return NewDefaultStoreItemAdapter(func(doc map[string]interface{}) StoreItem {
+		mark := &DeletionMark{}
+		mark.Key, _ = doc["key"].(string)
+		mark.DeletedBy, _ = doc["deletedBy"].(string)
+		if at, ok := doc["deletedAt"].(string); ok {
+			mark.DeletedAt, _ = time.Parse(time.RFC3339Nano, at)
+		}
+		return mark
+	})
+}
+
+// SoftDeleteStore wraps a Store marking removed items deleted instead of removing them,
+// reads only see live items. Deleted items stay in the wrapped store until purged,
+// their marks are kept in a second store, save and load both to keep tombstones across restarts.
+// Remove, RemoveWhere and Clear soft delete, Load replaces the live items and undeletes loaded keys.
+// Adding a key that is deleted fails with ErrAlreadyExists, Restore or Purge it first.
+// It implements ContextStore, the actor is taken from the context, see WithActor
+type SoftDeleteStore struct {
+	store Store
+	marks Store
+	// Clock time source, nil means time.Now
+	Clock Clock
+
+	mutex sync.Mutex
+}
+
+// NewSoftDeleteStore wraps store keeping deletion marks in marks, a DeletionMark adapter is registered for it.
+// nil marks keeps them in memory, in a SimpleStore named "<name>/deleted"
+func NewSoftDeleteStore(store Store, marks Store) *SoftDeleteStore {
+	if marks == nil {
+		marks = &SimpleStore{Name: store.GetName() + "/deleted"}
+	}
+	RegisterStoreAdapter(marks, NewDeletionMarkAdapter())
+	return &SoftDeleteStore{store: store, marks: marks}
+}
+
+// Marks returns the store keeping the deletion marks
+func (s *SoftDeleteStore) Marks() Store {
+	return s.marks
+}
+
+// deleted returns the marks by key
+func (s *SoftDeleteStore) deleted() map[string]*DeletionMark {
+	marks := make(map[string]*DeletionMark)
+	for _, item := range s.marks.All() {
+		if mark, ok := item.(*DeletionMark); ok {
+			marks[mark.Key] = mark
+		}
+	}
+	return marks
+}
+
+// live returns a filter matching items that aren't deleted and match filter
+func (s *SoftDeleteStore) live(filter Filter) Filter {
+	deleted := s.deleted()
+	return func(item StoreItem) bool {
+		if _, ok := deleted[keyString(item.GetKey())]; ok {
+			return false
+		}
+		return filter == nil || filter(item)
+	}
+}
+
+// Deleted implements SoftDeleter.Deleted
+func (s *SoftDeleteStore) Deleted() []Tombstone {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	deleted := s.deleted()
+	tombstones := make([]Tombstone, 0, len(deleted))
+	for _, item := range s.store.All() {
+		if mark, ok := deleted[keyString(item.GetKey())]; ok {
+			tombstones = append(tombstones, Tombstone{Item: item, DeletedAt: mark.DeletedAt, DeletedBy: mark.DeletedBy})
+		}
+	}
+	sort.SliceStable(tombstones, func(i, j int) bool {
+		if tombstones[i].DeletedAt.Equal(tombstones[j].DeletedAt) {
+			return keyString(tombstones[i].Item.GetKey()) < keyString(tombstones[j].Item.GetKey())
+		}
+		return tombstones[i].DeletedAt.Before(tombstones[j].DeletedAt)
+	})
+	return tombstones
+}
+
+// Restore implements SoftDeleter.Restore, ErrNotFound if key isn't deleted
+func (s *SoftDeleteStore) Restore(key interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.marks.RemoveWhere(KeyEqualsFilter(keyString(key)))
+}
+
+// Purge implements SoftDeleter.Purge, Purge(0) empties the bin
+func (s *SoftDeleteStore) Purge(olderThan time.Duration) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	limit := s.Clock.Now().Add(-olderThan)
+	purged := make(map[string]bool)
+	for key, mark := range s.deleted() {
+		if !mark.DeletedAt.After(limit) {
+			purged[key] = true
+		}
+	}
+	if len(purged) == 0 {
+		return 0
+	}
+	isPurged := func(item StoreItem) bool {
+		return purged[keyString(item.GetKey())]
+	}
+	_, count := Where(s.store, isPurged)
+	// items first, a failure leaves them marked to purge again
+	if count > 0 && s.store.RemoveWhere(isPurged) != nil {
+		return 0
+	}
+	s.marks.RemoveWhere(isPurged)
+	return count
+}
+
+// bury marks the live items matching filter deleted, ErrNotFound if none, caller holds the lock
+func (s *SoftDeleteStore) bury(ctx context.Context, filter Filter) error {
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	items, count := Where(s.store, s.live(filter))
+	if count == 0 {
+		return ErrNotFound
+	}
+	now := s.Clock.Now()
+	actor := ActorFrom(ctx)
+	for _, item := range items {
+		if e := s.marks.Add(&DeletionMark{Key: keyString(item.GetKey()), DeletedAt: now, DeletedBy: actor}); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// GetName implements Store.GetName
+func (s *SoftDeleteStore) GetName() string {
+	return s.store.GetName()
+}
+
+// AllContext implements ContextStore.AllContext
+func (s *SoftDeleteStore) AllContext(ctx context.Context) ([]StoreItem, error) {
+	if e := ctx.Err(); e != nil {
+		return nil, ErrCanceled.Wrap(e)
+	}
+	return s.All(), nil
+}
+
+// FindContext implements ContextStore.FindContext
+func (s *SoftDeleteStore) FindContext(ctx context.Context, filter Filter) (StoreItem, error) {
+	if e := ctx.Err(); e != nil {
+		return nil, ErrCanceled.Wrap(e)
+	}
+	return s.Find(filter)
+}
+
+// LoadContext implements ContextStore.LoadContext, deleted items not loaded again are kept
+func (s *SoftDeleteStore) LoadContext(ctx context.Context, items ...StoreItem) error {
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	loaded := make(map[string]bool, len(items))
+	for _, item := range items {
+		loaded[keyString(item.GetKey())] = true
+	}
+	deleted := s.deleted()
+	all := append([]StoreItem{}, items...)
+	for _, item := range s.store.All() {
+		key := keyString(item.GetKey())
+		if _, ok := deleted[key]; ok && !loaded[key] {
+			all = append(all, item)
+		}
+	}
+	if e := s.store.Load(all...); e != nil {
+		return e
+	}
+	s.marks.RemoveWhere(func(item StoreItem) bool {
+		return loaded[keyString(item.GetKey())]
+	})
+	return nil
+}
+
+// AddContext implements ContextStore.AddContext
+func (s *SoftDeleteStore) AddContext(ctx context.Context, item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, deleted := s.deleted()[keyString(item.GetKey())]; deleted {
+		return ErrAlreadyExists.Wrap(fmt.Errorf("%v is deleted", item.GetKey()))
+	}
+	return s.store.Add(item)
+}
+
+// RemoveContext implements ContextStore.RemoveContext
+func (s *SoftDeleteStore) RemoveContext(ctx context.Context, item StoreItem) error {
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bury(ctx, KeyEqualsFilter(item.GetKey()))
+}
+
+// ClearContext implements ContextStore.ClearContext
+func (s *SoftDeleteStore) ClearContext(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e := s.bury(ctx, Always); e != nil && e != ErrNotFound {
+		return e
+	}
+	return nil
+}
+
+// RemoveWhereContext implements ContextStore.RemoveWhereContext
+func (s *SoftDeleteStore) RemoveWhereContext(ctx context.Context, filter Filter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bury(ctx, filter)
+}
+
+// ForEachContext implements ContextStore.ForEachContext, deleted items are passed over unchanged
+func (s *SoftDeleteStore) ForEachContext(ctx context.Context, f Mutator) error {
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	deleted := s.deleted()
+	return s.store.ForEach(func(item StoreItem) (StoreItem, error) {
+		if _, ok := deleted[keyString(item.GetKey())]; ok {
+			return item, nil
+		}
+		return f(item)
+	})
+}
+
+// ForEachWhereContext implements ContextStore.ForEachWhereContext
+func (s *SoftDeleteStore) ForEachWhereContext(ctx context.Context, filter Filter, transform Mutator) error {
+	if e := ctx.Err(); e != nil {
+		return ErrCanceled.Wrap(e)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.store.ForEachWhere(s.live(filter), transform)
+}
+
+// All implements Store.All
+func (s *SoftDeleteStore) All() []StoreItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	items, _ := Where(s.store, s.live(nil))
+	if items == nil {
+		items = make([]StoreItem, 0)
+	}
+	return items
+}
+
+// Find implements Store.Find
+func (s *SoftDeleteStore) Find(filter Filter) (StoreItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.store.Find(s.live(filter))
+}
+
+// Load implements Store.Load
+func (s *SoftDeleteStore) Load(items ...StoreItem) error {
+	return s.LoadContext(context.Background(), items...)
+}
+
+// Add implements Store.Add
+func (s *SoftDeleteStore) Add(item StoreItem) error {
+	return s.AddContext(context.Background(), item)
+}
+
+// Remove implements Store.Remove
+func (s *SoftDeleteStore) Remove(item StoreItem) error {
+	return s.RemoveContext(context.Background(), item)
+}
+
+// Clear implements Store.Clear
+func (s *SoftDeleteStore) Clear() {
+	s.ClearContext(context.Background())
+}
+
+// RemoveWhere implements Store.RemoveWhere
+func (s *SoftDeleteStore) RemoveWhere(filter Filter) error {
+	return s.RemoveWhereContext(context.Background(), filter)
+}
+
+// ForEach implements Store.ForEach
+func (s *SoftDeleteStore) ForEach(f Mutator) error {
+	return s.ForEachContext(context.Background(), f)
+}
+
+// ForEachWhere implements Store.ForEachWhere
+func (s *SoftDeleteStore) ForEachWhere(filter Filter, transform Mutator) error {
+	return s.ForEachWhereContext(context.Background(), filter, transform)
+}
@@ -0,0 +1,173 @@
+package tinystore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"github.com/D10221/tinystore"
+)
+
+// Test_SoftDeleteStore
+func Test_SoftDeleteStore(t *testing.T) {
+
+	clock, advance := fakeClock()
+	store := tinystore.NewSoftDeleteStore(&tinystore.SimpleStore{}, nil)
+	store.Clock = clock
+	store.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"}, &DumyyItem{"c", "3"})
+
+	ctx := tinystore.WithActor(context.Background(), "alice")
+	if e := store.RemoveContext(ctx, &DumyyItem{"a", "1"}); e != nil {
+		t.Error(e)
+		return
+	}
+	advance(time.Hour)
+	store.RemoveWhere(NameFilter("b"))
+
+	if tinystore.Length(store) != 1 || tinystore.Exists(store, NameFilter("a")) {
+		t.Error("Deleted items should be hidden")
+		return
+	}
+	if _, e := tinystore.FindByKey(store, "b"); e != tinystore.ErrNotFound {
+		t.Error("Should not find b")
+		return
+	}
+	deleted := tinystore.Deleted(store)
+	if len(deleted) != 2 || deleted[0].Item.GetKey() != "a" || deleted[0].DeletedBy != "alice" || deleted[1].DeletedBy != "" {
+		t.Errorf("Bad tombstones: %+v", deleted)
+		return
+	}
+
+	if e := store.Add(&DumyyItem{"a", "new"}); !errors.Is(e, tinystore.ErrAlreadyExists) {
+		t.Errorf("Deleted keys should be protected: %v", e)
+		return
+	}
+	if e := store.Restore("a"); e != nil {
+		t.Error(e)
+		return
+	}
+	if item, e := tinystore.FindByKey(store, "a"); e != nil || item.(*DumyyItem).Password != "1" {
+		t.Error("Should restore a")
+		return
+	}
+	if e := store.Restore("a"); e != tinystore.ErrNotFound {
+		t.Error("a is not deleted")
+		return
+	}
+
+	advance(time.Hour)
+	store.Clear()
+	if tinystore.Length(store) != 0 || len(tinystore.Deleted(store)) != 3 {
+		t.Error("Clear should soft delete")
+		return
+	}
+	advance(30 * time.Minute)
+	if purged := store.Purge(time.Hour); purged != 1 {
+		t.Errorf("Should purge b only, purged %d", purged)
+		return
+	}
+	if store.Purge(0) != 2 || len(tinystore.Deleted(store)) != 0 {
+		t.Error("Should purge everything")
+		return
+	}
+	if e := store.Add(&DumyyItem{"a", "new"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Deleted(&tinystore.SimpleStore{}) != nil {
+		t.Error("SimpleStore has no tombstones")
+		return
+	}
+}
+
+// Test_SoftDeleteStore_Persistence
+func Test_SoftDeleteStore_Persistence(t *testing.T) {
+
+	items := &tinystore.SimpleStore{Name: "SoftUsers"}
+	tinystore.RegisterStoreAdapter(items, tinystore.NewDefaultStoreItemAdapter(convert))
+	marks := &tinystore.SimpleStore{Name: "SoftUsers.deleted"}
+	store := tinystore.NewSoftDeleteStore(items, marks)
+	store.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"})
+	store.RemoveContext(tinystore.WithActor(context.Background(), "alice"), &DumyyItem{"a", "1"})
+
+	savedItems, e := tinystore.SaveJson(items)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	savedMarks, e := tinystore.SaveJson(store.Marks())
+	if e != nil {
+		t.Error(e)
+		return
+	}
+
+	// restarted
+	items = &tinystore.SimpleStore{Name: "SoftUsers"}
+	marks = &tinystore.SimpleStore{Name: "SoftUsers.deleted"}
+	store = tinystore.NewSoftDeleteStore(items, marks)
+	if e := tinystore.LoadJson(items, savedItems); e != nil {
+		t.Error(e)
+		return
+	}
+	if e := tinystore.LoadJson(marks, savedMarks); e != nil {
+		t.Error(e)
+		return
+	}
+	deleted := tinystore.Deleted(store)
+	if tinystore.Length(store) != 1 || len(deleted) != 1 || deleted[0].DeletedBy != "alice" || deleted[0].DeletedAt.IsZero() {
+		t.Errorf("Tombstones should survive: %+v", deleted)
+		return
+	}
+	if e := store.Restore("a"); e != nil || tinystore.Length(store) != 2 {
+		t.Errorf("Should restore after a restart: %v", e)
+		return
+	}
+}
+
+// Test_SoftDeleteStore_Canceled
+func Test_SoftDeleteStore_Canceled(t *testing.T) {
+
+	sharded := tinystore.NewShardedStore("Sharded", 4)
+	sharded.Load(&DumyyItem{"a", "1"}, &DumyyItem{"b", "2"})
+	store := tinystore.NewSoftDeleteStore(sharded, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if e := store.RemoveWhereContext(ctx, tinystore.Always); !errors.Is(e, tinystore.ErrCanceled) {
+		t.Errorf("Should be canceled: %v", e)
+		return
+	}
+	if tinystore.Length(store) != 2 || len(tinystore.Deleted(store)) != 0 {
+		t.Error("Nothing should be deleted")
+		return
+	}
+	store.RemoveWhere(tinystore.Always)
+	if tinystore.Length(sharded) != 2 || len(tinystore.Deleted(store)) != 2 {
+		t.Error("Deleted items should stay in the wrapped store")
+		return
+	}
+	if store.Purge(0) != 2 || tinystore.Length(sharded) != 0 {
+		t.Error("Purge should remove them")
+		return
+	}
+}
+
+// Test_SoftDeleteStore_ForEach
+func Test_SoftDeleteStore_ForEach(t *testing.T) {
+
+	items := &tinystore.SimpleStore{}
+	store := tinystore.NewSoftDeleteStore(items, nil)
+	store.Load(&DumyyItem{"a", "12"}, &DumyyItem{"b", "34"}, &DumyyItem{"c", "56"}, &DumyyItem{"d", "78"})
+	store.Remove(&DumyyItem{"d", "78"})
+
+	if e := store.ForEach(reversePassword); e != nil {
+		t.Error(e)
+		return
+	}
+	for key, password := range map[string]string{"a": "21", "b": "43", "c": "65", "d": "78"} {
+		if item, _ := tinystore.FindByKey(items, key); item.(*DumyyItem).Password != password {
+			t.Errorf("%s should be %s, deleted items unchanged", key, password)
+			return
+		}
+	}
+}
@@ -3,6 +3,9 @@ package tinystore
 import (
 	"io/ioutil"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 )
 
 // StoreItem interface
@@ -71,20 +74,57 @@ type Store interface {
 
 }
 
+// Updater is implemented by stores able to update items atomically
+type Updater interface {
+	// Upsert adds item or replaces the item with the same key
+	Upsert(item StoreItem) error
+
+	// Replace the item with the same key, ErrNotFound if the key is absent
+	Replace(item StoreItem) error
+
+	// UpdateByKey applies mutator to the item matching key
+	UpdateByKey(key interface{}, mutator Mutator) error
+
+	// Patch applies a JSON Merge Patch (RFC 7386) to the item matching key,
+	// the patched document is converted back through the store's StoreItemAdapter
+	Patch(key interface{}, patch map[string]interface{}) error
+}
+
 // StoreError this package error
 type StoreError struct {
 	Message string
 	Code    int
+	// Err wrapped cause, if any
+	Err error
 }
 
 // Error implements error interface
 func (e StoreError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
 	return e.Message
 }
 
+// Unwrap returns the wrapped cause
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches StoreErrors by Code, so errors.Is(err, ErrCanceled) holds for wrapped causes
+func (e *StoreError) Is(target error) bool {
+	t, ok := target.(*StoreError)
+	return ok && t.Code == e.Code
+}
+
 // NewError helper
 func NewError(message string , code int) *StoreError {
-	return &StoreError{message, code}
+	return &StoreError{Message: message, Code: code}
+}
+
+// Wrap returns a copy of e wrapping cause
+func (e *StoreError) Wrap(cause error) *StoreError {
+	return &StoreError{Message: e.Message, Code: e.Code, Err: cause}
 }
 
 var (
@@ -99,6 +139,72 @@ var (
 
 	// ErrNotImplemented
 	ErrNotImplemented = NewError("Not Implemented", 4)
+
+	// ErrBatchAborted item was valid but the atomic batch failed
+	ErrBatchAborted = NewError("Batch Aborted", 5)
+
+	// ErrVersionConflict item changed since the expected version was read
+	ErrVersionConflict = NewError("Version Conflict", 6)
+
+	// ErrReadOnly store can't be modified
+	ErrReadOnly = NewError("Read Only Store", 7)
+
+	// ErrHistoryDisabled store is not keeping history
+	ErrHistoryDisabled = NewError("History Disabled", 8)
+
+	// ErrCanceled context done before the operation completed, wraps ctx.Err()
+	ErrCanceled = NewError("Canceled", 9)
+
+	// ErrCapacityExceeded nothing could be evicted to make room
+	ErrCapacityExceeded = NewError("Capacity Exceeded", 10)
+
+	// ErrNoTenant item has no tenant
+	ErrNoTenant = NewError("Tenant Required", 11)
+
+	// ErrQuotaExceeded tenant item quota reached
+	ErrQuotaExceeded = NewError("Quota Exceeded", 12)
+
+	// ErrPermissionDenied no rule allows the operation
+	ErrPermissionDenied = NewError("Permission Denied", 13)
+
+	// ErrDecryptionFailed wrong key or tampered data, AES-GCM can't tell which
+	ErrDecryptionFailed = NewError("Decryption Failed, wrong key or tampered data", 14)
+
+	// ErrInvalidEncryptedData not an encrypted store or unsupported parameters
+	ErrInvalidEncryptedData = NewError("Invalid Encrypted Data", 15)
+
+	// ErrNoSecretKey secrets need a key, see SetSecretKey
+	ErrNoSecretKey = NewError("Secret Key Not Set", 16)
+
+	// ErrInvalidCredentials unknown user or wrong password, deliberately not telling which
+	ErrInvalidCredentials = NewError("Invalid Credentials", 17)
+
+	// ErrInvalidHash encoded password hash can't be parsed or has no registered Hasher
+	ErrInvalidHash = NewError("Invalid Password Hash", 18)
+
+	// ErrIntegrity data doesn't match its checksums
+	ErrIntegrity = NewError("Integrity Check Failed", 19)
+
+	// ErrInvalidSignature bundle signature doesn't verify
+	ErrInvalidSignature = NewError("Invalid Signature", 20)
+
+	// ErrUnsigned bundle isn't signed
+	ErrUnsigned = NewError("Unsigned Bundle", 21)
+
+	// ErrNothingToUndo journal has no step to undo
+	ErrNothingToUndo = NewError("Nothing To Undo", 22)
+
+	// ErrNothingToRedo journal has no step to redo
+	ErrNothingToRedo = NewError("Nothing To Redo", 23)
+
+	// ErrUnknownEvent no reducer is registered for the event type
+	ErrUnknownEvent = NewError("Unknown Event", 24)
+
+	// ErrClosed store was closed
+	ErrClosed = NewError("Store Closed", 25)
+
+	// ErrNotReplayed event store hasn't replayed its log yet
+	ErrNotReplayed = NewError("Event Log Not Replayed", 26)
 )
 
 
@@ -186,6 +292,25 @@ func RegisterStoreAdapter(store Store, adapter StoreItemAdapter)  error {
 	return nil
 }
 
+// LookupAdapter returns the StoreItemAdapter registered for name
+func LookupAdapter(name string) (StoreItemAdapter, bool) {
+	adapter, exists := StoreAdapters[name]
+	return adapter, exists
+}
+
+// adapterNamer is implemented by stores whose items use the adapter registered under another name
+type adapterNamer interface {
+	adapterName() string
+}
+
+// adapterName returns the name the adapter of store is registered under
+func adapterName(store Store) string {
+	if namer, ok := store.(adapterNamer); ok {
+		return namer.adapterName()
+	}
+	return store.GetName()
+}
+
 
 
 // LoadJson
@@ -199,22 +324,110 @@ func LoadJsonFile(store Store,path string) error {
 }
 
 
-// LoadJson
+// LoadJson, reads plain arrays and SaveJson files, whose checksums are verified,
+// plain arrays are rejected with ErrIntegrity once SetIntegrityKey was called
 func LoadJson(store Store,bytes []byte) error {
+	return loadJson(store, bytes, false)
+}
 
-	items:= make([]map[string]interface{}, 0)
+// LoadVerifiedJson like LoadJson but fails with ErrIntegrity unless bytes carry valid checksums
+func LoadVerifiedJson(store Store, bytes []byte) error {
+	return loadJson(store, bytes, true)
+}
 
-	e := json.Unmarshal(bytes, &items)
+// LoadVerifiedJsonFile reads path and loads it like LoadVerifiedJson
+func LoadVerifiedJsonFile(store Store, path string) error {
+	bytes, e := ioutil.ReadFile(path)
 	if e != nil {
 		return e
 	}
+	return LoadVerifiedJson(store, bytes)
+}
 
-	adapter, exists := StoreAdapters[store.GetName()]
+func loadJson(store Store, bytes []byte, verified bool) error {
+
+	items, integrity, e := parseDocuments(bytes)
+	if e != nil {
+		return e
+	}
+	if integrity == nil && (verified || integrityRequired()) {
+		return ErrIntegrity.Wrap(fmt.Errorf("no checksums"))
+	}
+
+	adapter, exists := LookupAdapter(adapterName(store))
 	if !exists {
 		return ErrNotFound
 	}
 
-	e = store.Load(adapter.ConvertMany(items)...)
+	raw, e := canonicalDocuments(items)
+	if e != nil {
+		return e
+	}
+	if e = openDocuments(items, secretKeysOf(adapterName(store))); e != nil {
+		return e
+	}
+	converted := adapter.ConvertMany(items)
+	for _, item := range converted {
+		if e = openItem(item); e != nil {
+			return e
+		}
+	}
+	if integrity != nil {
+		if e = integrity.verify(converted, raw); e != nil {
+			return e
+		}
+	}
+
+	e = store.Load(converted...)
 
 	return e
 }
+
+// SaveJson returns the store items with their checksums, the format LoadJson reads, secrets are sealed
+func SaveJson(store Store) ([]byte, error) {
+	return saveJson(adapterName(store), store.All())
+}
+
+// saveJson returns items of a store whose adapter is registered as name, as SaveJson does
+func saveJson(name string, items []StoreItem) ([]byte, error) {
+	docs, e := sealDocuments(name, items)
+	if e != nil {
+		return nil, e
+	}
+	integrity, e := integrityOf(items, docs)
+	if e != nil {
+		return nil, e
+	}
+	return json.MarshalIndent(integrityFile{Integrity: integrity, Items: docs}, "", "  ")
+}
+
+// SaveJsonFile writes SaveJson to path, replacing it atomically
+func SaveJsonFile(store Store, path string) error {
+	bytes, e := SaveJson(store)
+	if e != nil {
+		return e
+	}
+	return writeFile(path, bytes)
+}
+
+// writeFile writes a temporary file next to path and renames it over path,
+// readers see either the old or the new content
+func writeFile(path string, bytes []byte) error {
+	file, e := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(file.Name())
+	if _, e = file.Write(bytes); e != nil {
+		file.Close()
+		return e
+	}
+	if e = file.Chmod(0600); e != nil {
+		file.Close()
+		return e
+	}
+	if e = file.Close(); e != nil {
+		return e
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,155 @@
+package tinystore
+
+// Versioned is implemented by stores tracking a version per key for optimistic concurrency,
+// a key version is the store revision at which the item last changed,
+// so it keeps increasing even if the key is removed and added again
+type Versioned interface {
+	// Revision store wide, increased by every mutation
+	Revision() uint64
+
+	// Version of the item matching key, ErrNotFound if absent
+	Version(key interface{}) (uint64, error)
+
+	// FindVersion as Store.Find also returning the item version
+	FindVersion(filter Filter) (StoreItem, uint64, error)
+
+	// CompareAndSwap replaces the item matching key with item if its version is still expected,
+	// expected 0 adds item if key is absent
+	CompareAndSwap(key interface{}, expected uint64, item StoreItem) error
+
+	// RemoveVersion removes the item matching key if its version is still expected
+	RemoveVersion(key interface{}, expected uint64) error
+}
+
+// RevisionLoader is implemented by stores able to replace every item at once
+// only if nothing changed since a revision, see Versioned.Revision
+type RevisionLoader interface {
+	// LoadRevision as Store.Load if the store revision is still expected, ErrVersionConflict otherwise
+	LoadRevision(expected uint64, items ...StoreItem) error
+}
+
+// bump starts a new revision, caller holds the lock
+func (store *SimpleStore) bump() {
+	store.revision++
+}
+
+// touch marks item key as changed at the current revision, caller holds the lock
+func (store *SimpleStore) touch(item StoreItem) {
+	key := item.GetKey()
+	if store.versions == nil {
+		store.versions = make(map[interface{}]uint64)
+	}
+	store.versions[key] = store.revision
+	if store.history != nil {
+		store.history.record(key, item, store.revision, store.Clock.Now())
+	}
+}
+
+// forget drops key version, caller holds the lock
+func (store *SimpleStore) forget(key interface{}) {
+	delete(store.versions, key)
+	if store.history != nil {
+		store.history.record(key, nil, store.revision, store.Clock.Now())
+	}
+}
+
+// forgetAll forgets every key in the store, caller holds the lock
+func (store *SimpleStore) forgetAll() {
+	for _, x := range store.load() {
+		store.forget(x.GetKey())
+	}
+	store.versions = nil
+}
+
+// Revision implements Versioned.Revision
+func (store *SimpleStore) Revision() uint64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.revision
+}
+
+// Version implements Versioned.Version
+func (store *SimpleStore) Version(key interface{}) (uint64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if version, ok := store.versions[key]; ok {
+		return version, nil
+	}
+	return 0, ErrNotFound
+}
+
+// FindVersion implements Versioned.FindVersion
+func (store *SimpleStore) FindVersion(filter Filter) (StoreItem, uint64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, x := range store.load() {
+		if filter(x) {
+			return x, store.versions[x.GetKey()], nil
+		}
+	}
+	return nil, 0, ErrNotFound
+}
+
+// CompareAndSwap implements Versioned.CompareAndSwap
+func (store *SimpleStore) CompareAndSwap(key interface{}, expected uint64, item StoreItem) error {
+
+	if item == nil {
+		return ErrInvalidStoreItem
+	}
+	if ex := item.Validate(); ex != nil {
+		return ex
+	}
+	if item.GetKey() != key {
+		return ErrInvalidStoreItem
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	i := store.indexOf(key)
+	if i < 0 {
+		if expected != 0 {
+			return ErrVersionConflict
+		}
+		store.append(item)
+		return nil
+	}
+	if store.versions[key] != expected {
+		return ErrVersionConflict
+	}
+	return store.replaceAt(i, item)
+}
+
+// LoadRevision implements RevisionLoader.LoadRevision
+func (store *SimpleStore) LoadRevision(expected uint64, items ...StoreItem) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.revision != expected {
+		return ErrVersionConflict
+	}
+	store.reload(items)
+	return nil
+}
+
+// RemoveVersion implements Versioned.RemoveVersion
+func (store *SimpleStore) RemoveVersion(key interface{}, expected uint64) error {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	i := store.indexOf(key)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if store.versions[key] != expected {
+		return ErrVersionConflict
+	}
+
+	current := store.load()
+	result := make([]StoreItem, 0, len(current)-1)
+	result = append(result, current[:i]...)
+	store.publish(append(result, current[i+1:]...))
+	store.bump()
+	store.forget(key)
+	return nil
+}
@@ -0,0 +1,90 @@
+package tinystore_test
+
+import (
+	"testing"
+	"github.com/D10221/tinystore"
+)
+
+// Test_Versions
+func Test_Versions(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+
+	if _, e := store.Version("me"); e != tinystore.ErrNotFound {
+		t.Error("Should be NotFound")
+		return
+	}
+
+	store.Add(&DumyyItem{"me", "1234"})
+	store.Add(&DumyyItem{"you", "1234"})
+
+	me, _ := store.Version("me")
+	you, _ := store.Version("you")
+	if me == 0 || you <= me || store.Revision() != you {
+		t.Errorf("Bad versions me: %v, you: %v, revision: %v", me, you, store.Revision())
+		return
+	}
+
+	store.Replace(&DumyyItem{"me", "4321"})
+	if v, _ := store.Version("me"); v <= you {
+		t.Error("Version didn't increase")
+	}
+	if _, v, e := store.FindVersion(NameFilter("you")); e != nil || v != you {
+		t.Error("Untouched version changed")
+	}
+
+	// removed and added again keeps increasing
+	last := store.Revision()
+	store.Remove(&DumyyItem{"me", "4321"})
+	store.Add(&DumyyItem{"me", "1234"})
+	if v, _ := store.Version("me"); v <= last {
+		t.Error("Version reused")
+	}
+}
+
+// Test_CompareAndSwap
+func Test_CompareAndSwap(t *testing.T) {
+
+	store := &tinystore.SimpleStore{}
+
+	if e := store.CompareAndSwap("me", 1, &DumyyItem{"me", "1234"}); e != tinystore.ErrVersionConflict {
+		t.Error("Should conflict")
+		return
+	}
+	if e := store.CompareAndSwap("me", 0, &DumyyItem{"me", "1234"}); e != nil {
+		t.Error(e)
+		return
+	}
+
+	_, version, _ := store.FindVersion(NameFilter("me"))
+
+	// someone else changes it
+	store.Upsert(&DumyyItem{"me", "abcd"})
+
+	if e := store.CompareAndSwap("me", version, &DumyyItem{"me", "4321"}); e != tinystore.ErrVersionConflict {
+		t.Error("Should conflict")
+		return
+	}
+	if e := store.RemoveVersion("me", version); e != tinystore.ErrVersionConflict {
+		t.Error("Should conflict")
+		return
+	}
+
+	version, _ = store.Version("me")
+	if e := store.CompareAndSwap("me", version, &DumyyItem{"me", "4321"}); e != nil {
+		t.Error(e)
+		return
+	}
+	if x, _ := tinystore.FindByKey(store, "me"); AsCredential(x).Password != "4321" {
+		t.Error("Swap Failed")
+	}
+
+	version, _ = store.Version("me")
+	if e := store.RemoveVersion("me", version); e != nil {
+		t.Error(e)
+		return
+	}
+	if tinystore.Length(store) != 0 {
+		t.Error("Remove Failed")
+	}
+}